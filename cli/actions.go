@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"bytes"
+	"doglog/consts"
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCooldown is the minimum number of seconds between two runs of the same --exec command.
+const DefaultCooldown = 30
+
+// Prefix added to the environment variables that carry the message fields.
+const actionEnvPrefix = "DOGLOG_"
+
+// messageMatcher decides whether a normalized log message matches a rule.
+type messageMatcher func(msg *datadogV2.Log) bool
+
+// matchAction is a command that is run when a message matches a rule.
+type matchAction struct {
+	mu       sync.Mutex
+	rule     string
+	matches  messageMatcher
+	command  string
+	cooldown time.Duration
+	lastRun  time.Time
+}
+
+// The actions requested with --on-match/--exec.
+var matchActions []*matchAction
+
+// Build the actions from the --on-match rules and the --exec commands. Rules and commands are paired in order.
+func setupMatchActions(opts options.Options) error {
+	if len(opts.OnMatch) != len(opts.Exec) {
+		return fmt.Errorf("each --on-match rule needs exactly one --exec command (found %d rules and %d commands)",
+			len(opts.OnMatch), len(opts.Exec))
+	}
+	if len(opts.OnMatch) > 0 && !opts.DoTail {
+		return fmt.Errorf("--on-match and --exec can only be used with --tail")
+	}
+	if len(opts.Cooldowns) > 1 && len(opts.Cooldowns) != len(opts.OnMatch) {
+		return fmt.Errorf("give a single --cooldown for every rule or one per --on-match rule (found %d rules and %d cooldowns)",
+			len(opts.OnMatch), len(opts.Cooldowns))
+	}
+	for i, rule := range opts.OnMatch {
+		matcher, err := compileMatcher(rule)
+		if err != nil {
+			return fmt.Errorf("invalid --on-match rule '%s' - %s", rule, err)
+		}
+		matchActions = append(matchActions, &matchAction{
+			rule:     rule,
+			matches:  matcher,
+			command:  opts.Exec[i],
+			cooldown: time.Duration(ruleCooldown(opts.Cooldowns, i)) * time.Second,
+		})
+	}
+	return nil
+}
+
+// The cooldown of the rule in a position: its own --cooldown, the single --cooldown shared by every rule, or the
+// default.
+func ruleCooldown(cooldowns []int, i int) int {
+	switch len(cooldowns) {
+	case 0:
+		return DefaultCooldown
+	case 1:
+		return cooldowns[0]
+	}
+	return cooldowns[i]
+}
+
+// Compile a rule into a matcher. A rule wrapped in slashes, e.g. '/Timeout.*Exception/', is a regular expression
+// applied to the message text. Anything else is a list of terms that must all match: 'key:value' compares a field
+// (with '*' wildcards), bare words must appear in the message text, and a leading '-' negates a term.
+func compileMatcher(rule string) (messageMatcher, error) {
+	rule = strings.TrimSpace(rule)
+	if len(rule) > 1 && strings.HasPrefix(rule, "/") && strings.HasSuffix(rule, "/") {
+		re, err := regexp.Compile(rule[1 : len(rule)-1])
+		if err != nil {
+			return nil, err
+		}
+		return func(msg *datadogV2.Log) bool {
+			return re.MatchString(getField(msg.AdditionalProperties, consts.ComputedMessageField))
+		}, nil
+	}
+
+	var terms []messageMatcher
+	for _, term := range splitTerms(rule) {
+		negate := false
+		if len(term) > 1 && strings.HasPrefix(term, "-") {
+			negate = true
+			term = term[1:]
+		}
+		var matcher messageMatcher
+		if key, value, found := strings.Cut(term, ":"); found && len(key) > 0 {
+			key = strings.TrimPrefix(key, "@")
+			pattern := globPattern(strings.Trim(value, "\""))
+			matcher = func(msg *datadogV2.Log) bool {
+				return pattern.MatchString(getField(msg.AdditionalProperties, key))
+			}
+		} else {
+			text := strings.ToLower(strings.Trim(term, "\""))
+			matcher = func(msg *datadogV2.Log) bool {
+				return strings.Contains(strings.ToLower(getField(msg.AdditionalProperties, consts.ComputedMessageField)), text)
+			}
+		}
+		if negate {
+			inner := matcher
+			matcher = func(msg *datadogV2.Log) bool { return !inner(msg) }
+		}
+		terms = append(terms, matcher)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("the rule is empty")
+	}
+
+	return func(msg *datadogV2.Log) bool {
+		for _, t := range terms {
+			if !t(msg) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// Convert a value with '*' and '?' wildcards into a case-insensitive regular expression matching the whole value.
+func globPattern(value string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	for _, r := range value {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// Split a rule into terms on whitespace, keeping double-quoted text together.
+func splitTerms(rule string) []string {
+	var terms []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range rule {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t') && !quoted:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms
+}
+
+// Wrap a message handler so the --exec commands run for every message matching their --on-match rule.
+func triggerActions(handle messageHandler) messageHandler {
+	return func(opts *options.Options, msg *datadogV2.Log) {
+		handle(opts, msg)
+		for _, a := range matchActions {
+			if a.matches(msg) && a.ready() {
+				a.run(opts, msg)
+			}
+		}
+	}
+}
+
+// Check whether the cooldown for the action has expired, and if so, start a new one.
+func (a *matchAction) ready() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if !a.lastRun.IsZero() && now.Sub(a.lastRun) < a.cooldown {
+		return false
+	}
+	a.lastRun = now
+	return true
+}
+
+// Run the action's command in the background. The message is written to the command's stdin as JSON and its fields
+// are available as environment variables.
+func (a *matchAction) run(opts *options.Options, msg *datadogV2.Log) {
+	cmd := shellCommand(a.command)
+	cmd.Stdin = bytes.NewReader(messageJson(*msg))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), actionEnvironment(a.rule, msg)...)
+
+	if err := cmd.Start(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't run --exec command '%s' - %s\n", a.command, err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "The --exec command '%s' failed - %s\n", a.command, err)
+		}
+	}()
+}
+
+// Build the environment variables for an action. Each string field of the message becomes DOGLOG_<FIELD>, with the
+// computed '__' fields taking precedence over the raw fields of the same name.
+func actionEnvironment(rule string, msg *datadogV2.Log) []string {
+	values := make(map[string]string)
+	for _, computed := range []bool{false, true} {
+		for k := range msg.AdditionalProperties {
+			if isColorField(k) || k == consts.ComputedJsonField || strings.HasPrefix(k, "__") != computed {
+				continue
+			}
+			if value := getField(msg.AdditionalProperties, k); len(value) > 0 {
+				values[environmentName(k)] = value
+			}
+		}
+	}
+	values[actionEnvPrefix+"RULE"] = rule
+
+	env := make([]string, 0, len(values))
+	for k, v := range values {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// Convert a field name into an environment variable name, e.g. '__short_classname' becomes DOGLOG_SHORT_CLASSNAME.
+func environmentName(field string) string {
+	name := strings.ToUpper(strings.TrimLeft(field, "_"))
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	return actionEnvPrefix + name
+}
+
+// Build a command that is run by the user's shell.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"doglog/config"
+	"doglog/log"
+	"doglog/options"
+	"encoding/json"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/akamensky/argparse"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// DefaultGroups is the number of groups returned for each facet when no limit is provided by the user
+const DefaultGroups = 10
+
+// The flags of the aggregate subcommand.
+type aggregateFlags struct {
+	scope   *scopeFlags
+	end     *string
+	by      *[]string
+	compute *[]string
+	limit   *int
+	json    *bool
+}
+
+// Add the flags of the aggregate subcommand.
+func addAggregateFlags(cmd *argparse.Command) *aggregateFlags {
+	return &aggregateFlags{
+		scope:   addScopeFlags(cmd),
+		end:     addEndFlag(cmd),
+		by:      cmd.StringList("b", "by", &argparse.Options{Required: false, Help: "A facet to group the messages by, e.g., 'status', 'host' or '@http.status_code'. Repeat the parameter to group by several facets"}),
+		compute: cmd.StringList("", "compute", &argparse.Options{Required: false, Help: "What to compute for each group: 'count', or an aggregation and a measure, e.g., 'avg:@duration'. The aggregations are count, cardinality, sum, min, max, avg, median, pc75, pc90, pc95, pc98 and pc99. Repeat the parameter to compute several values", Default: []string{"count"}}),
+		limit:   cmd.Int("l", "limit", &argparse.Options{Required: false, Help: "The maximum number of groups for each facet", Default: DefaultGroups}),
+		json:    cmd.Flag("j", "json", &argparse.Options{Required: false, Help: "Output the groups in json format."}),
+	}
+}
+
+// Copy the aggregate flags into the options.
+func (f *aggregateFlags) apply(opts *options.Options) {
+	f.scope.apply(opts)
+	opts.EndDate = *f.end
+	opts.GroupBy = *f.by
+	opts.Compute = *f.compute
+	opts.Limit = *f.limit
+	opts.OutputJson = *f.json
+}
+
+// A single group of the aggregation: the values of the facets and the computed values.
+type aggregateGroup struct {
+	By       map[string]string  `json:"by"`
+	Computes map[string]float64 `json:"computes"`
+}
+
+// Parse a compute, e.g. 'count' or 'avg:@duration'.
+func parseCompute(spec string) (datadogV2.LogsCompute, error) {
+	name, metric, _ := strings.Cut(spec, ":")
+	aggregation, err := datadogV2.NewLogsAggregationFunctionFromValue(strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return datadogV2.LogsCompute{}, fmt.Errorf("unknown aggregation in '%s'", spec)
+	}
+	compute := datadogV2.LogsCompute{Aggregation: *aggregation, Type: datadogV2.LOGSCOMPUTETYPE_TOTAL.Ptr()}
+	if len(metric) > 0 {
+		compute.Metric = datadog.PtrString(metric)
+	} else if *aggregation != datadogV2.LOGSAGGREGATIONFUNCTION_COUNT {
+		return datadogV2.LogsCompute{}, fmt.Errorf("the aggregation '%s' needs a measure, e.g., '%s:@duration'", name, name)
+	}
+	return compute, nil
+}
+
+// Run an aggregation and return the groups, sorted by the first computed value.
+func aggregate(opts *options.Options, groupBy []string, specs []string, limit int) ([]aggregateGroup, error) {
+	var computes []datadogV2.LogsCompute
+	for _, spec := range specs {
+		compute, err := parseCompute(spec)
+		if err != nil {
+			return nil, err
+		}
+		computes = append(computes, compute)
+	}
+	if len(computes) == 0 {
+		computes = append(computes, datadogV2.LogsCompute{Aggregation: datadogV2.LOGSAGGREGATIONFUNCTION_COUNT})
+	}
+
+	var groups []datadogV2.LogsGroupBy
+	for _, facet := range groupBy {
+		groups = append(groups, datadogV2.LogsGroupBy{
+			Facet: facet,
+			Limit: datadog.PtrInt64(int64(limit)),
+			Sort: &datadogV2.LogsAggregateSort{
+				Aggregation: computes[0].Aggregation.Ptr(),
+				Metric:      computes[0].Metric,
+				Order:       datadogV2.LOGSSORTORDER_DESCENDING.Ptr(),
+				Type:        datadogV2.LOGSAGGREGATESORTTYPE_MEASURE.Ptr(),
+			},
+		})
+	}
+
+	body := datadogV2.LogsAggregateRequest{
+		Compute: computes,
+		Filter: &datadogV2.LogsQueryFilter{
+			Query:   &opts.Query,
+			From:    &opts.StartDate,
+			To:      &opts.EndDate,
+			Indexes: opts.Indexes,
+		},
+		GroupBy: groups,
+		Options: &datadogV2.LogsQueryOptions{
+			Timezone: datadog.PtrString("UTC"),
+		},
+	}
+
+	ctx := constructDatadogContext(opts)
+	resp, _, err := datadogV2.NewLogsApi(apiClient(opts)).AggregateLogs(ctx, body)
+	if err != nil {
+		log.Error(*opts, "Error when calling `LogsApi.AggregateLogs`: %v", err)
+		return nil, apiError(err)
+	}
+
+	var result []aggregateGroup
+	for _, bucket := range resp.GetData().Buckets {
+		g := aggregateGroup{By: make(map[string]string), Computes: make(map[string]float64)}
+		for facet, value := range bucket.By {
+			g.By[facet], _ = config.FieldString(value)
+		}
+		for i, spec := range specs {
+			if value, ok := bucket.Computes[fmt.Sprintf("c%d", i)]; ok && value.LogsAggregateBucketValueSingleNumber != nil {
+				g.Computes[spec] = *value.LogsAggregateBucketValueSingleNumber
+			}
+		}
+		result = append(result, g)
+	}
+	if len(specs) > 0 {
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].Computes[specs[0]] > result[j].Computes[specs[0]]
+		})
+	}
+	return result, nil
+}
+
+// CommandAggregate Print the computed values for every group of the log messages that match the search criteria.
+func CommandAggregate(opts *options.Options) int {
+	groups, err := aggregate(opts, opts.GroupBy, opts.Compute, opts.Limit)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't aggregate the log messages - %s\n", err)
+		return 1
+	}
+
+	if opts.OutputJson {
+		for _, g := range groups {
+			buf, _ := json.Marshal(g)
+			fmt.Println(string(buf))
+		}
+		return 0
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No log messages found.")
+		return 0
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, strings.Join(append(append([]string{}, opts.GroupBy...), opts.Compute...), "\t"))
+	for _, g := range groups {
+		var columns []string
+		for _, facet := range opts.GroupBy {
+			columns = append(columns, g.By[facet])
+		}
+		for _, spec := range opts.Compute {
+			columns = append(columns, formatNumber(g.Computes[spec]))
+		}
+		_, _ = fmt.Fprintln(w, strings.Join(columns, "\t"))
+	}
+	_ = w.Flush()
+	return 0
+}
+
+// Format a computed value, without decimals when it's a whole number.
+func formatNumber(value float64) string {
+	s, _ := config.FieldString(value)
+	if i := strings.Index(s, "."); i >= 0 && len(s)-i > 3 {
+		return fmt.Sprintf("%.2f", value)
+	}
+	return s
+}
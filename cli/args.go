@@ -4,12 +4,15 @@ import (
 	"doglog/config"
 	"doglog/log"
 	"doglog/options"
+	"doglog/query"
+	"errors"
 	"fmt"
-	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/akamensky/argparse"
 	"golang.org/x/term"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // DefaultLimit is the value used when no limit is provided by the user
@@ -21,69 +24,294 @@ const DefaultRange = "now-15m"
 // DefaultConfigName is the default location of the configuration path.
 const DefaultConfigName = ".doglog"
 
+// Help text of the config file argument.
+const configHelp = "Path to the config file. By default these files are merged, later files overriding earlier ones: /etc/doglog/config, $XDG_CONFIG_HOME/doglog/config, ~/.doglog, and the .doglog files found from the repository root or the home directory down to the current directory"
+
 var defaultIndices = []string{"main"}
 
 var AppVersion = ""
 
+// The subcommands. Search is used when no subcommand is given, so the flat invocation, e.g. 'doglog -s api -t',
+// keeps working.
+const (
+	SearchCommand     = "search"
+	TailCommand       = "tail"
+	AggregateCommand  = "aggregate"
+	FieldsCommand     = "fields"
+	GetCommand        = "get"
+	FormatsCommand    = "formats"
+	IndexesCommand    = "indexes"
+	CompletionCommand = "completion"
+	ServicesCommand   = "services"
+	OpenCommand       = "open"
+	ConfigCommand     = "config"
+	SecretsCommand    = "secrets"
+)
+
+// The subcommands, in the order they are listed in the help.
+var commandNames = []string{SearchCommand, TailCommand, AggregateCommand, FieldsCommand, GetCommand, FormatsCommand, IndexesCommand, ServicesCommand, OpenCommand, ConfigCommand, SecretsCommand, CompletionCommand}
+
 // ParseArgs parses the command-line arguments and returns the *options
 // which contain the parsed command-line arguments.
 func ParseArgs(appVersion string) *options.Options {
 	AppVersion = appVersion
-	opts := initializeArgumentParser()
+	opts := initializeArgumentParser(defaultCommand(os.Args))
+	return &opts
+}
 
-	// Display the application version. Put this here in case there's an error in
-	// the succeeding code
-	if opts.Version {
-		fmt.Println(AppVersion)
-		os.Exit(0)
+// Insert the search subcommand when no subcommand is given. The flags used by every subcommand may come before the
+// subcommand, e.g. 'doglog -c ./test.doglog config check', so they are moved after it for the parser.
+func defaultCommand(args []string) []string {
+	var leading []string
+	i := 1
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-c" || arg == "--config" || arg == "--timezone" {
+			leading = append(leading, args[i:min(i+2, len(args))]...)
+			i++
+		} else if containsString(globalFlags, arg) || strings.HasPrefix(arg, "--config=") || strings.HasPrefix(arg, "--timezone=") {
+			leading = append(leading, arg)
+		} else {
+			break
+		}
 	}
 
-	return &opts
+	result := []string{args[0]}
+	if i < len(args) && (containsString(commandNames, args[i]) || args[i] == "-h" || args[i] == "--help") {
+		result = append(result, args[i])
+		i++
+	} else {
+		result = append(result, SearchCommand)
+	}
+	result = append(result, args[min(i, len(args)):]...)
+	return append(result, leading...)
 }
 
-// Set up the argument parser and return the options selected
-func initializeArgumentParser() options.Options {
-	parser := argparse.NewParser("datadog", "Search and tail logs from Datadog.")
-	defaultConfigPath := defaultConfigFile()
+// The flags without a value that are used by every subcommand.
+var globalFlags = []string{"-d", "--debug", "--no-colors", "-v", "--version"}
+
+// The flags that select the log messages of a search, shared by every subcommand that fetches log messages.
+type scopeFlags struct {
+	service *string
+	query   *string
+	indexes *[]string
+	start   *string
+	filters *queryFlags
+}
+
+// Add the flags that select log messages to a subcommand.
+func addScopeFlags(cmd *argparse.Command) *scopeFlags {
+	return &scopeFlags{
+		service: cmd.String("s", "service", &argparse.Options{Required: false, Help: serviceHelp}),
+		query:   cmd.String("q", "query", &argparse.Options{Required: false, Help: "Query terms to search on (Datadog search syntax). Bare text will search only the message field. You can specify attributes use an '@' sign, e.g., '@level:INFO'. Keep in mind that `doglog` cleans up levels", Default: "*"}),
+		indexes: cmd.StringList("i", "indices", &argparse.Options{Required: false, Help: "The list of indices to search in Datadog. Repeat the parameter to add indices to the list", Default: defaultIndices}),
+		start:   cmd.String("", "start", &argparse.Options{Required: false, Help: startHelp, Default: DefaultRange}),
+		filters: addQueryFlags(cmd),
+	}
+}
+
+// Add the --end flag to a subcommand.
+func addEndFlag(cmd *argparse.Command) *string {
+	return cmd.String("", "end", &argparse.Options{Required: false, Help: endHelp, Default: "now"})
+}
+
+// Copy the scope flags into the options.
+func (f *scopeFlags) apply(opts *options.Options) {
+	opts.Service = *f.service
+	opts.Query = *f.query
+	opts.Indexes = *f.indexes
+	opts.StartDate = *f.start
+	f.filters.apply(opts)
+}
+
+// The flags shared by the subcommands that search for log messages.
+type searchFlags struct {
+	scope      *scopeFlags
+	json       *bool
+	long       *bool
+	limit      *int
+	level      *string
+	summary    *bool
+	pipe       *string
+	pipeOutput *bool
+	onMatch    *[]string
+	exec       *[]string
+	cooldown   *[]int
+	url        *bool
+}
 
+// Add the flags that filter and display log messages to a subcommand.
+func addSearchFlags(cmd *argparse.Command) *searchFlags {
+	return &searchFlags{
+		scope:      addScopeFlags(cmd),
+		json:       cmd.Flag("j", "json", &argparse.Options{Required: false, Help: "Output messages in json format. Shows the modified log message, not the untouched message from Datadog. Useful in understanding the fields available when creating Format templates or for further processing."}),
+		long:       cmd.Flag("", "long", &argparse.Options{Required: false, Help: "Generate long output", Default: false}),
+		limit:      cmd.Int("l", "limit", &argparse.Options{Required: false, Help: "The maximum number of messages to request from Datadog. Must be greater then 0. A search stops there and says so on stderr, tailing uses it as the size of each request", Default: DefaultLimit}),
+		level:      cmd.String("", "level", &argparse.Options{Required: false, Help: "Only show messages at this level or more severe, e.g., '--level WARN'. Levels are normalized using the [levels] section of the config file: TRACE, DEBUG, INFO, NOTICE, WARN, ERROR, CRITICAL, FATAL"}),
+		summary:    cmd.Flag("", "summary", &argparse.Options{Required: false, Help: "After the last message, print counts by level, service, host and classname, the first and last timestamps, and the number of pages fetched. When tailing, the summary is printed on exit."}),
+		pipe:       cmd.String("", "pipe", &argparse.Options{Required: false, Help: "A shell command that is started once and receives every message as a line of JSON (NDJSON) on its stdin. Its output goes to stderr unless --pipe-output is used"}),
+		pipeOutput: cmd.Flag("", "pipe-output", &argparse.Options{Required: false, Help: "Use the lines written by the --pipe command as the output instead of the formatted messages."}),
+		onMatch:    cmd.StringList("", "on-match", &argparse.Options{Required: false, Help: "A rule that triggers the --exec command in the same position when tailing. Either a regular expression in slashes matched against the message text, e.g., '/Timeout.*Exception/', or terms that must all match, e.g., '__level:ERROR __classname:*Payment* timeout'. Repeat the parameter to add rules"}),
+		exec:       cmd.StringList("", "exec", &argparse.Options{Required: false, Help: "A shell command to run when a message matches the --on-match rule in the same position. The message is written to the command's stdin as JSON and its fields are available in DOGLOG_<FIELD> environment variables, e.g., DOGLOG_LEVEL. Requires tailing"}),
+		cooldown:   cmd.IntList("", "cooldown", &argparse.Options{Required: false, Help: "The minimum number of seconds between two runs of the --exec command in the same position. A single --cooldown applies to every rule, otherwise repeat it once per --on-match rule. Defaults to " + strconv.Itoa(DefaultCooldown)}),
+		url:        cmd.Flag("", "url", &argparse.Options{Required: false, Help: "Print the Log Explorer URL of the search on stderr, with the time range resolved to absolute times, before the messages. Each message's own link is in the __url field"}),
+	}
+}
+
+// Copy the search flags into the options.
+func (f *searchFlags) apply(opts *options.Options) {
+	f.scope.apply(opts)
+	opts.OutputJson = *f.json
+	opts.UseLong = *f.long
+	opts.Limit = *f.limit
+	opts.MinLevel = strings.ToUpper(*f.level)
+	opts.Summary = *f.summary
+	opts.Pipe = *f.pipe
+	opts.PipeOutput = *f.pipeOutput
+	opts.OnMatch = *f.onMatch
+	opts.Exec = *f.exec
+	opts.Cooldowns = *f.cooldown
+	opts.PrintUrl = *f.url
+}
+
+// Help text of the service argument. The flag isn't declared as required since only some subcommands need it, see
+// needsService.
+const serviceHelp = "The Datadog log 'service' to constrain the log search, e.g., '-s send-email', or '-s ~recon' for the only service whose name contains 'recon'. Required by search, tail, fields and open, and by formats test without --input"
+
+// Help text of the start argument.
+const startHelp = "Starting date/time to search from. The start and end parameters can be: 1) a date and time in most common formats, e.g., '2024-07-11 08:45', '2024-07-11T08:45:00+02:00' or 'July 11 2024 8:45am', in the --timezone when it has none, 2) a day and time such as 'yesterday 14:00', 'today 9:30' or just '9:30', 3) a unix timestamp in seconds (10 digits) or milliseconds (13 digits), 4) a relative time such as '2h ago' or the date math -2d to subtract two days, +1h to add one hour, etc. The units are s for seconds, m for minutes, h for hours, d for days and w for weeks, and now is the current time, 5) a marker of the [markers] section of the config file, e.g., '@deploy'. The times are resolved locally and the range is printed on stderr"
+
+// Help text of the end argument.
+const endHelp = "Ending date/time to search from, in the same formats as --start. Must be after --start. Defaults to 'now' if --start is provided but no --end"
+
+// Set up the argument parser and return the options selected
+func initializeArgumentParser(args []string) options.Options {
+	parser := argparse.NewParser("doglog", "Search and tail logs from Datadog.")
 	parser.HelpFunc = customHelp
 
-	configPath := parser.String("c", "config", &argparse.Options{Required: false, Help: "Path to the config file", Default: defaultConfigPath})
+	// Flags used by every subcommand
+	configPath := parser.String("c", "config", &argparse.Options{Required: false, Help: configHelp})
 	debug := parser.Flag("d", "debug", &argparse.Options{Required: false, Help: "Generate debug output."})
-	indexes := parser.StringList("i", "indices", &argparse.Options{Required: false, Help: "The list of indices to search in Datadog. Repeat the parameter to add indices to the list", Default: defaultIndices})
-	json := parser.Flag("j", "json", &argparse.Options{Required: false, Help: "Output messages in json format. Shows the modified log message, not the untouched message from Datadog. Useful in understanding the fields available when creating Format templates or for further processing."})
-	limit := parser.Int("l", "limit", &argparse.Options{Required: false, Help: "The maximum number of messages to request from Datadog. Must be greater then 0", Default: DefaultLimit})
-	long := parser.Flag("", "long", &argparse.Options{Required: false, Help: "Generate long output", Default: false})
 	noColor := parser.Flag("", "no-colors", &argparse.Options{Required: false, Help: "Don't use colors in output. Automatically turned off when redirecting output."})
-	query := parser.String("q", "query", &argparse.Options{Required: false, Help: "Query terms to search on (Datadog search syntax). Bare text will search only the message field. You can specify attributes use an '@' sign, e.g., '@level:INFO'. Keep in mind that `doglog` cleans up levels", Default: "*"})
-	service := parser.String("s", "service", &argparse.Options{Required: true, Help: "The Datadog log 'service' to constrain the log search, e.g., '-s send-email'."})
-	start := parser.String("", "start", &argparse.Options{Required: false, Help: "Starting date/time to search from. The start and end parameters can be: 1) an ISO-8601 string using the FULL format of '2024-07-11T08:45:00+00:00', 2) a unix timestamp (number representing the elapsed milliseconds since epoch), 3) a date math string such as +1h to add one hour, -2d to subtract two days, etc. The full list includes s for seconds, m for minutes, h for hours, and d for days. Optionally, use now to indicate current time", Default: DefaultRange})
-	end := parser.String("", "end", &argparse.Options{Required: false, Help: "Ending date/time to search from. Uses Datadog format. Defaults to 'now' if --start is provided but no --end", Default: "now"})
-	tail := parser.Flag("t", "tail", &argparse.Options{Required: false, Help: "Whether to tail the output. Requires a relative search."})
 	version := parser.Flag("v", "version", &argparse.Options{Required: false, Help: "Display the application version and exit."})
+	timezone := parser.String("", "timezone", &argparse.Options{Required: false, Help: "The timezone of the --start and --end times that don't have one and of the range printed on stderr, e.g., 'Europe/Paris' or 'UTC'. Defaults to the local timezone"})
+
+	searchCmd := parser.NewCommand(SearchCommand, "Search for log messages. This is the default when no subcommand is given.")
+	search := addSearchFlags(searchCmd)
+	end := addEndFlag(searchCmd)
+	histogram := searchCmd.Flag("", "histogram", &argparse.Options{Required: false, Help: "Display a bar chart of the number of log messages from --start to --end, split by level, instead of the messages themselves. The messages are counted by Datadog by their status, so the chart takes a single request whatever the range. Cannot be used with --tail."})
+	tail := searchCmd.Flag("t", "tail", &argparse.Options{Required: false, Help: "Whether to tail the output. Requires a relative search. Same as the tail subcommand."})
+
+	tailCmd := parser.NewCommand(TailCommand, "Tail log messages as they arrive. Requires a relative --start.")
+	tailSearch := addSearchFlags(tailCmd)
+
+	aggregateCmd := parser.NewCommand(AggregateCommand, "Count log messages, or compute metrics over them, grouped by facets.")
+	aggregate := addAggregateFlags(aggregateCmd)
+
+	fieldsCmd := parser.NewCommand(FieldsCommand, "List the fields found in a sample of log messages, to help write formats.")
+	fields := addFieldsFlags(fieldsCmd)
 
-	if err := parser.Parse(os.Args); err != nil {
+	getCmd := parser.NewCommand(GetCommand, "Display a single log message by its id.")
+	get := addGetFlags(getCmd)
+
+	formats := addFormatsCommands(parser)
+
+	indexesCmd := parser.NewCommand(IndexesCommand, "List the log indexes with their filter, retention and daily limit.")
+	indexes := addIndexesFlags(indexesCmd)
+
+	servicesCmd := parser.NewCommand(ServicesCommand, "List the services that logged recently. The services of the last day are cached and used to complete -s.")
+	services := addServicesFlags(servicesCmd)
+
+	openCmd := parser.NewCommand(OpenCommand, "Open the Log Explorer on a search in the default browser.")
+	open := addOpenFlags(openCmd)
+
+	config := addConfigCommands(parser)
+	secrets := addSecretsCommands(parser)
+	completion := addCompletionCommand(parser)
+
+	// The parser insists on a subcommand, even for help
+	if len(args) == 2 && (args[1] == "-h" || args[1] == "--help") {
+		fmt.Print(customHelp(&parser.Command, nil))
+		os.Exit(0)
+	}
+
+	if err := parser.Parse(args); err != nil {
 		invalidArgs(parser, err, "")
 	}
 
-	if start == nil {
-		start = datadog.PtrString("")
+	// Display the application version. Put this here in case there's an error in
+	// the succeeding code
+	if *version {
+		fmt.Println(AppVersion)
+		os.Exit(0)
 	}
 
 	opts := options.Options{
-		Service:    *service,
-		Query:      *query,
-		Limit:      *limit,
-		DoTail:     *tail,
 		ConfigPath: *configPath,
-		StartDate:  *start,
-		EndDate:    *end,
-		OutputJson: *json,
 		UseColor:   !*noColor && isTty(),
 		PrintDebug: *debug,
-		Indexes:    *indexes,
-		UseLong:    *long,
 		Version:    *version,
+		EndDate:    "now",
+		Timezone:   *timezone,
+	}
+
+	switch {
+	case config.happened():
+		os.Exit(config.run(&opts))
+	case secrets.happened():
+		os.Exit(secrets.run(&opts))
+	case completion.happened():
+		os.Exit(completion.run(&opts, parser))
+	case searchCmd.Happened():
+		opts.Command = SearchCommand
+		search.apply(&opts)
+		opts.EndDate = *end
+		opts.Histogram = *histogram
+		if *tail {
+			opts.Command = TailCommand
+			opts.DoTail = true
+		}
+	case tailCmd.Happened():
+		opts.Command = TailCommand
+		tailSearch.apply(&opts)
+		opts.DoTail = true
+	case aggregateCmd.Happened():
+		opts.Command = AggregateCommand
+		aggregate.apply(&opts)
+	case fieldsCmd.Happened():
+		opts.Command = FieldsCommand
+		fields.apply(&opts)
+	case getCmd.Happened():
+		opts.Command = GetCommand
+		get.apply(&opts)
+	case formats.happened():
+		opts.Command = FormatsCommand
+		formats.apply(&opts)
+	case indexesCmd.Happened():
+		opts.Command = IndexesCommand
+		indexes.apply(&opts)
+	case servicesCmd.Happened():
+		opts.Command = ServicesCommand
+		services.apply(&opts)
+	case openCmd.Happened():
+		opts.Command = OpenCommand
+		open.apply(&opts)
+	}
+
+	if needsService(opts) && len(opts.Service) == 0 {
+		invalidArgs(parser, nil, "The -s/--service argument is required")
+	}
+
+	if opts.PipeOutput && len(opts.Pipe) == 0 {
+		invalidArgs(parser, nil, "The --pipe-output argument requires --pipe")
+	}
+
+	if opts.Histogram && opts.DoTail {
+		invalidArgs(parser, nil, "The --histogram and --tail arguments cannot be used together")
+	}
+
+	if err := setupMatchActions(opts); err != nil {
+		invalidArgs(parser, err, "")
 	}
 
 	if opts.Limit <= 0 {
@@ -91,45 +319,130 @@ func initializeArgumentParser() options.Options {
 		opts.Limit = newLimit
 	}
 
+	filters, err := queryFilters(opts)
+	if err != nil {
+		invalidArgs(parser, err, "")
+	}
+	text := addFilters(filters, opts.Query)
+	// Check the query before resolving the service, which can call the API
+	checkQuery(constructQuery(strings.TrimPrefix(opts.Service, "~"), text))
+
 	opts.ServerConfig = loadConfigFile(opts, parser, &opts.ConfigPath)
 
-	opts.Query = constructQuery(opts.Service, opts.Query)
+	if len(opts.MinLevel) > 0 {
+		levels := opts.ServerConfig.Levels()
+		opts.MinLevel = levels.Normalize(opts.MinLevel)
+		if _, ok := levels.Severity(opts.MinLevel); !ok {
+			invalidArgs(parser, nil, fmt.Sprintf("Unknown --level '%s', use one of %s", opts.MinLevel, strings.Join(levels.Names(), ", ")))
+		}
+	}
+
+	if err := resolveRange(&opts); err != nil {
+		invalidArgs(parser, err, "")
+	}
+
+	if opts.Command != ServicesCommand && len(opts.Input) == 0 {
+		service, err := resolveService(&opts)
+		if err != nil {
+			invalidArgs(parser, err, "")
+		}
+		opts.Service = service
+	}
+
+	opts.Query = constructQuery(opts.Service, text)
 	log.Debug(opts, "Computed query '%s'", opts.Query)
+	log.Debug(opts, "Normalized query '%s'", checkQuery(opts.Query))
 
 	return opts
 }
 
+// Check whether the subcommand requires the -s/--service argument.
+func needsService(opts options.Options) bool {
+	switch opts.Command {
+	case GetCommand, AggregateCommand, IndexesCommand, ServicesCommand:
+		return false
+	case FormatsCommand:
+		return len(opts.Input) == 0
+	}
+	return true
+}
+
+// Validate the query before it's sent to Datadog, which returns nothing or an opaque error for an invalid query. The
+// error is shown under the query with a caret. Returns the normalized query.
+func checkQuery(text string) string {
+	normalized, err := query.Normalize(text)
+	if err != nil {
+		var syntaxError *query.Error
+		if errors.As(err, &syntaxError) {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid query - %s\n\n%s\n", syntaxError.Message, indent(syntaxError.Caret(), "  "))
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid query - %s\n", err)
+		}
+		os.Exit(1)
+	}
+	return normalized
+}
+
+// Indent every line of a text.
+func indent(text string, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
 // Add 'service:' to the query
-func constructQuery(service string, query string) string {
+func constructQuery(service string, text string) string {
 	var newQuery string
 	if len(service) > 0 {
 		newQuery = "service:" + service
-		if len(query) > 0 {
-			newQuery += " " + query
+		if len(text) > 0 {
+			newQuery += " " + groupQuery(text)
 		}
-		query = newQuery
+		text = newQuery
 	}
-	return query
+	return text
 }
 
 // Load the configuration
 func loadConfigFile(opts options.Options, parser *argparse.Parser, configPath *string) *config.IniFile {
-	testPath, err := filepath.Abs(*configPath)
+	paths, err := configPaths(*configPath)
 	if err != nil {
-		invalidArgs(parser, err, "Config file path is invalid")
-	}
-	if _, err := os.Stat(testPath); os.IsNotExist(err) {
-		invalidArgs(parser, err, "Config file does not exist")
+		invalidArgs(parser, err, "")
 	}
-	// Read the configuration file
-	conf, err := config.New(opts.ConfigPath)
+	// Read the configuration files
+	conf, err := config.New(paths...)
 	if err != nil {
 		invalidArgs(parser, err, "")
 	}
+	if err := conf.CheckPermissions(os.Stderr); err != nil {
+		invalidArgs(parser, err, "")
+	}
+	for _, warning := range conf.ProjectWarnings() {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
 
 	return conf
 }
 
+// Determine the configuration files to read: the file given on the command-line, or the files found in the
+// search path.
+func configPaths(configPath string) ([]string, error) {
+	if len(configPath) > 0 {
+		testPath, err := filepath.Abs(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("config file path is invalid: %s", err)
+		}
+		if _, err := os.Stat(testPath); os.IsNotExist(err) {
+			return nil, fmt.Errorf("config file does not exist: %s", err)
+		}
+		return []string{testPath}, nil
+	}
+
+	paths := config.SearchPaths()
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no config file found, run 'doglog config init' to create %s", defaultConfigFile())
+	}
+	return paths, nil
+}
+
 // Determine the default configuration file location
 func defaultConfigFile() string {
 	dirname, err := os.UserHomeDir()
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"doglog/options"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long the cached service and index names are used before they are fetched again.
+const cacheTTL = 24 * time.Hour
+
+// How long after fetching the service or index names an unknown name waits before fetching them again.
+const refreshInterval = 5 * time.Minute
+
+// How long after failing to fetch the service or index names they aren't fetched again, except when asked for.
+const failureTTL = time.Hour
+
+// The error returned instead of fetching again a cache entry that failed recently.
+var errRecentFailure = errors.New("failed recently, not fetched again")
+
+// A cached value with the time it was fetched.
+type cacheEntry struct {
+	Updated time.Time       `json:"updated"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// The file of a cache entry, under the user cache directory. Entries are kept per site, since each site is a
+// different organization.
+func cachePath(opts *options.Options, name string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	site := "datadoghq.com"
+	if opts.ServerConfig != nil && len(opts.ServerConfig.Site()) > 0 {
+		site = opts.ServerConfig.Site()
+	}
+	return filepath.Join(dir, "doglog", name+"-"+strings.ReplaceAll(site, string(filepath.Separator), "_")+".json"), nil
+}
+
+// Read a cache entry into value. Returns false when there's no entry or it's older than ttl.
+func readCache(opts *options.Options, name string, ttl time.Duration, value interface{}) bool {
+	path, err := cachePath(opts, name)
+	if err != nil {
+		return false
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(buf, &entry); err != nil || time.Since(entry.Updated) > ttl {
+		return false
+	}
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+// Write a cache entry. The cache is only an optimization, so failures are ignored.
+func writeCache(opts *options.Options, name string, value interface{}) {
+	path, err := cachePath(opts, name)
+	if err != nil {
+		return
+	}
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	buf, err = json.Marshal(cacheEntry{Updated: time.Now(), Value: buf})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, buf, 0600)
+}
+
+// Record that fetching a cache entry failed, e.g. because the application key can't read it.
+func recordFailure(opts *options.Options, name string) {
+	writeCache(opts, name+"-failed", time.Now())
+}
+
+// Check whether fetching a cache entry failed during the last failureTTL.
+func recentFailure(opts *options.Options, name string) bool {
+	var failed time.Time
+	return readCache(opts, name+"-failed", failureTTL, &failed)
+}
+
+// Check whether fetching a cache entry again was attempted during the last refreshInterval, and record the attempt
+// otherwise. The attempt is recorded even when it fails, so an unknown name doesn't query Datadog on every run.
+func recentRefresh(opts *options.Options, name string) bool {
+	var attempted time.Time
+	if readCache(opts, name+"-refresh", refreshInterval, &attempted) {
+		return true
+	}
+	writeCache(opts, name+"-refresh", time.Now())
+	return false
+}
+
+// The log indexes, from the cache when it's fresh. After a failure, the indexes aren't listed again for failureTTL
+// unless refresh is set.
+func cachedIndexes(opts *options.Options, refresh bool) ([]logIndex, error) {
+	var indexes []logIndex
+	if !refresh && readCache(opts, "indexes", cacheTTL, &indexes) {
+		return indexes, nil
+	}
+	if !refresh && recentFailure(opts, "indexes") {
+		return nil, errRecentFailure
+	}
+	indexes, err := listIndexes(opts)
+	if err != nil {
+		recordFailure(opts, "indexes")
+		return nil, err
+	}
+	writeCache(opts, "indexes", indexes)
+	return indexes, nil
+}
@@ -2,16 +2,28 @@ package cli
 
 import (
 	"context"
+	"doglog/consts"
 	"doglog/log"
 	"doglog/options"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
-	"github.com/briandowns/spinner"
+	"os"
+	"strings"
 )
 
-// Print out a page of log messages that match the search criteria.
+// The largest page requested from Datadog when searching, so a large --limit is fetched in several pages.
+const maxPageSize = 1000
+
+// messageHandler is called with every log message fetched from Datadog.
+type messageHandler func(opts *options.Options, msg *datadogV2.Log)
+
+// Hand a page of log messages that match the search criteria to the message handler. Returns the cursor of the next
+// page, nil after the last page, and the number of messages in the page.
 func listMessages(ctx context.Context, logsApi *datadogV2.LogsApi,
-	opts *options.Options, cursor *string) (*string, bool) {
+	opts *options.Options, cursor *string, pageSize int, handle messageHandler) (*string, int, error) {
 	body := datadogV2.LogsListRequest{
 		Filter: &datadogV2.LogsQueryFilter{
 			Query:   &opts.Query,
@@ -23,24 +35,59 @@ func listMessages(ctx context.Context, logsApi *datadogV2.LogsApi,
 			Timezone: datadog.PtrString("UTC"),
 		},
 		Page: &datadogV2.LogsListRequestPage{
-			Limit:  datadog.PtrInt32(int32(opts.Limit)),
+			Limit:  datadog.PtrInt32(int32(pageSize)),
 			Cursor: cursor,
 		},
 		Sort: datadogV2.LOGSSORT_TIMESTAMP_ASCENDING.Ptr(),
 	}
 
-	items, _ := logsApi.ListLogsWithPagination(ctx, *datadogV2.NewListLogsOptionalParameters().WithBody(body))
+	resp, _, err := logsApi.ListLogs(ctx, *datadogV2.NewListLogsOptionalParameters().WithBody(body))
+	if err != nil {
+		log.Error(*opts, "Error when calling `LogsApi.ListLogs`: %v", err)
+		return nil, 0, apiError(err)
+	}
+	for i := range resp.Data {
+		handle(opts, &resp.Data[i])
+	}
 
-	for paginationResult := range items {
-		if paginationResult.Error != nil {
-			log.Error(*opts, "Error when calling `LogsApi.ListLogs`: %v", paginationResult.Error)
-			return nil, false
-		} else {
-			printMessage(opts, &paginationResult.Item)
-		}
+	// A page that isn't full is the last one
+	next := resp.GetMeta().Page.GetAfter()
+	if len(resp.Data) < pageSize || len(next) == 0 {
+		return nil, len(resp.Data), nil
 	}
+	return &next, len(resp.Data), nil
+}
 
-	return body.Page.Cursor, true
+// Add the reasons given in the body of a Datadog API error to the error, e.g. why a query is invalid. The error
+// itself only holds the HTTP status, e.g. '400 Bad Request'.
+func apiError(err error) error {
+	var openApiError datadog.GenericOpenAPIError
+	if !errors.As(err, &openApiError) || len(openApiError.Body()) == 0 {
+		return err
+	}
+	var body struct {
+		Errors []interface{} `json:"errors"`
+	}
+	if json.Unmarshal(openApiError.Body(), &body) != nil {
+		return err
+	}
+	var reasons []string
+	for _, e := range body.Errors {
+		switch reason := e.(type) {
+		case string:
+			reasons = append(reasons, reason)
+		case map[string]interface{}:
+			if detail, ok := reason["detail"].(string); ok && len(detail) > 0 {
+				reasons = append(reasons, detail)
+			} else if title, ok := reason["title"].(string); ok {
+				reasons = append(reasons, title)
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return err
+	}
+	return fmt.Errorf("%s - %s", err, strings.Join(reasons, "; "))
 }
 
 // Construct a datadog api client.
@@ -53,8 +100,12 @@ func apiClient(opts *options.Options) *datadog.APIClient {
 // Build the datadog context required for all api calls.
 // The context includes the api keys.
 func constructDatadogContext(opts *options.Options) context.Context {
+	ctx := context.Background()
+	if site := opts.ServerConfig.Site(); len(site) > 0 {
+		ctx = context.WithValue(ctx, datadog.ContextServerVariables, map[string]string{"site": site})
+	}
 	return context.WithValue(
-		context.Background(),
+		ctx,
 		datadog.ContextAPIKeys,
 		map[string]datadog.APIKey{
 			"apiKeyAuth": {
@@ -69,19 +120,61 @@ func constructDatadogContext(opts *options.Options) context.Context {
 
 // CommandListMessages Print out the log messages that match the search criteria.
 // Will continue until all pages of output are displayed.
-func CommandListMessages(opts *options.Options, s *spinner.Spinner) bool {
+func CommandListMessages(opts *options.Options, s *StatusLine) bool {
+	handle := messageHandler(printMessage)
+	if len(opts.Pipe) > 0 {
+		handle = pipeMessages(opts, handle)
+	}
+	if len(matchActions) > 0 {
+		handle = triggerActions(handle)
+	}
+	if opts.Summary {
+		handle = summarize(handle)
+	}
+	return fetchMessages(opts, s, filterLevel(opts, handle))
+}
+
+// Fetch the pages of log messages that match the search criteria and hand them to the message handler. A search stops
+// after --limit messages, tailing fetches every page of each poll.
+func fetchMessages(opts *options.Options, s *StatusLine, handle messageHandler) bool {
 	ctx := constructDatadogContext(opts)
 	logsApi := datadogV2.NewLogsApi(apiClient(opts))
 
+	if s != nil {
+		handle = recordStatus(s, handle)
+	}
+
 	var nextId *string
 	nextId = nil
 	result := false
+	fetched := 0
 	for {
 		if s != nil {
 			s.Stop()
 		}
-		nextId, result = listMessages(ctx, logsApi, opts, nextId)
+		pageSize := opts.Limit
+		if s == nil {
+			pageSize = min(opts.Limit-fetched, maxPageSize)
+		}
+		cursor := nextId
+		var err error
+		var count int
+		nextId, count, err = listMessages(ctx, logsApi, opts, cursor, pageSize, handle)
+		fetched += count
+		result = err == nil
+		if err != nil && s == nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Can't search the log messages - %s\n", err)
+		}
+		limited := s == nil && nextId != nil && fetched >= opts.Limit
+		if limited {
+			_, _ = fmt.Fprintf(os.Stderr, "Stopped after %d messages, more match the search - use -l to fetch more\n", fetched)
+			nextId = nil
+		}
+		if opts.Summary && summary != nil {
+			summary.recordPage(count, limited || err != nil && cursor != nil)
+		}
 		if s != nil {
+			s.SetError(err)
 			s.Start()
 		}
 		if nextId == nil {
@@ -92,3 +185,26 @@ func CommandListMessages(opts *options.Options, s *spinner.Spinner) bool {
 	}
 	return result
 }
+
+// Wrap a message handler so only the messages at the --level or more severe are handled.
+func filterLevel(opts *options.Options, handle messageHandler) messageHandler {
+	if len(opts.MinLevel) == 0 {
+		return handle
+	}
+	levels := opts.ServerConfig.Levels()
+	min, _ := levels.Severity(opts.MinLevel)
+	return func(opts *options.Options, msg *datadogV2.Log) {
+		adjustMap(opts, msg)
+		if severity, ok := levels.Severity(getField(msg.AdditionalProperties, consts.ComputedLevelField)); ok && severity >= min {
+			handle(opts, msg)
+		}
+	}
+}
+
+// Wrap a message handler so every message is counted in the status line.
+func recordStatus(s *StatusLine, handle messageHandler) messageHandler {
+	return func(opts *options.Options, msg *datadogV2.Log) {
+		handle(opts, msg)
+		s.Record(getField(msg.AdditionalProperties, consts.ComputedLevelField), msg.GetAttributes().Timestamp)
+	}
+}
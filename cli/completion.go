@@ -0,0 +1,355 @@
+package cli
+
+import (
+	"doglog/config"
+	"doglog/options"
+	"fmt"
+	"github.com/akamensky/argparse"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The shells that completion scripts are generated for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// The kinds of values completed dynamically, by the long name of the flag that takes them.
+var completionValues = map[string]string{
+	"service": "services",
+	"indices": "indexes",
+}
+
+// The 'completion' subcommand.
+type completionCommand struct {
+	cmd   *argparse.Command
+	shell *string
+	list  *string
+}
+
+// Add the 'completion' subcommand to the parser.
+func addCompletionCommand(parser *argparse.Parser) *completionCommand {
+	c := &completionCommand{}
+	c.cmd = parser.NewCommand(CompletionCommand, "Print the shell completion script, e.g., 'source <(doglog completion bash)'.")
+	c.shell = c.cmd.SelectorPositional(completionShells, &argparse.Options{Help: "The shell: " + strings.Join(completionShells, ", ")})
+	c.list = c.cmd.Selector("", "list", []string{"services", "indexes"}, &argparse.Options{Required: false, Help: "Print the values completed for a flag instead of the script: services or indexes. Used by the completion scripts, the services and indexes are cached for a day"})
+	return c
+}
+
+// Check whether the 'completion' subcommand was given.
+func (c *completionCommand) happened() bool {
+	return c.cmd.Happened()
+}
+
+// Run the 'completion' subcommand and return the exit code.
+func (c *completionCommand) run(opts *options.Options, parser *argparse.Parser) int {
+	if len(*c.list) > 0 {
+		return CommandCompletionValues(opts, *c.list)
+	}
+	switch *c.shell {
+	case "bash":
+		fmt.Print(bashCompletion(&parser.Command))
+	case "zsh":
+		fmt.Print("#compdef doglog\nautoload -U +X bashcompinit && bashcompinit\n" + bashCompletion(&parser.Command))
+	case "fish":
+		fmt.Print(fishCompletion(&parser.Command))
+	default:
+		_, _ = fmt.Fprintf(os.Stderr, "The shell is required, one of %s\n", strings.Join(completionShells, ", "))
+		return 1
+	}
+	return 0
+}
+
+// CommandCompletionValues Print the values completed for a kind of flag, one per line. Nothing is printed when the
+// values can't be found, so completion never prints errors. Returns the exit code.
+func CommandCompletionValues(opts *options.Options, kind string) int {
+	paths, err := configPaths(opts.ConfigPath)
+	if err != nil {
+		return 0
+	}
+	if opts.ServerConfig, err = config.New(paths...); err != nil {
+		return 0
+	}
+
+	var values []string
+	switch kind {
+	case "services":
+		values, _ = cachedServices(opts, false)
+	case "indexes":
+		_, values = indexesByName(opts, false)
+	}
+	for _, value := range values {
+		fmt.Println(value)
+	}
+	return 0
+}
+
+// A command of the parser, with the words leading to it, e.g. 'formats test'.
+type completionPath struct {
+	path string
+	cmd  *argparse.Command
+}
+
+// List the commands of the parser, depth first, starting with the parser itself.
+func completionPaths(root *argparse.Command) []completionPath {
+	paths := []completionPath{{path: "", cmd: root}}
+	for i := 0; i < len(paths); i++ {
+		for _, child := range paths[i].cmd.GetCommands() {
+			paths = append(paths, completionPath{path: strings.TrimSpace(paths[i].path + " " + child.GetName()), cmd: child})
+		}
+	}
+	return paths
+}
+
+// The words completed after a command: its subcommands and the values of its positional argument.
+func completionWords(cmd *argparse.Command, path string) []string {
+	var words []string
+	for _, child := range cmd.GetCommands() {
+		words = append(words, child.GetName())
+	}
+	switch path {
+	case CompletionCommand:
+		words = append(words, completionShells...)
+	case SecretsCommand + " set":
+		words = append(words, config.SecretNames()...)
+	}
+	return words
+}
+
+// The flags of a command, with the flags of the commands above it, since they can be used too.
+func completionFlags(cmd *argparse.Command) []argparse.Arg {
+	var flags []argparse.Arg
+	for c := cmd; c != nil; c = c.GetParent() {
+		for _, arg := range c.GetArgs() {
+			if !arg.GetPositional() {
+				flags = append(flags, arg)
+			}
+		}
+	}
+	return flags
+}
+
+// The flags that take a file name.
+var completionFiles = []string{"config", "file", "key-file", "input"}
+
+// Check whether a flag takes a value. The help flag has a private type.
+func takesValue(arg argparse.Arg) bool {
+	_, isFlag := arg.GetResult().(*bool)
+	return !isFlag && arg.GetLname() != "help"
+}
+
+// The fish options completing the value of a flag: dynamic values, file names or nothing.
+func fishValues(arg argparse.Arg) string {
+	switch {
+	case !takesValue(arg):
+		return ""
+	case completionValues[arg.GetLname()] != "":
+		return fmt.Sprintf(" -x -a '(doglog completion --list %s 2>/dev/null)'", completionValues[arg.GetLname()])
+	case containsString(completionFiles, arg.GetLname()):
+		return " -r -F"
+	}
+	return " -x"
+}
+
+// Generate the bash completion script. It's also used for zsh, through bashcompinit.
+func bashCompletion(root *argparse.Command) string {
+	var subcommands, flags strings.Builder
+	for _, p := range completionPaths(root) {
+		_, _ = fmt.Fprintf(&subcommands, "    %q) echo %q ;;\n", p.path, strings.Join(completionWords(p.cmd, p.path), " "))
+		var names []string
+		for _, arg := range completionFlags(p.cmd) {
+			if len(arg.GetSname()) > 0 && !containsString(names, "-"+arg.GetSname()) {
+				names = append(names, "-"+arg.GetSname())
+			}
+			if !containsString(names, "--"+arg.GetLname()) {
+				names = append(names, "--"+arg.GetLname())
+			}
+		}
+		_, _ = fmt.Fprintf(&flags, "    %q) echo %q ;;\n", p.path, strings.Join(names, " "))
+	}
+
+	var values, files strings.Builder
+	var kinds []string
+	for name := range completionValues {
+		kinds = append(kinds, name)
+	}
+	sort.Strings(kinds)
+	for _, name := range kinds {
+		patterns := []string{"--" + name}
+		for _, p := range completionPaths(root) {
+			for _, arg := range p.cmd.GetArgs() {
+				if arg.GetLname() == name && len(arg.GetSname()) > 0 && !containsString(patterns, "-"+arg.GetSname()) {
+					patterns = append(patterns, "-"+arg.GetSname())
+				}
+			}
+		}
+		_, _ = fmt.Fprintf(&values, "    %s) echo %s ;;\n", strings.Join(patterns, "|"), completionValues[name])
+	}
+	for _, p := range completionPaths(root) {
+		for _, arg := range p.cmd.GetArgs() {
+			if containsString(completionFiles, arg.GetLname()) {
+				for _, name := range []string{"-" + arg.GetSname(), "--" + arg.GetLname()} {
+					if name != "-" && !strings.Contains("|"+files.String()+"|", "|"+name+"|") {
+						if files.Len() > 0 {
+							files.WriteString("|")
+						}
+						files.WriteString(name)
+					}
+				}
+			}
+		}
+	}
+
+	return `# doglog completion for bash, e.g. 'source <(doglog completion bash)'
+_doglog_subcommands() {
+  case "$1" in
+` + subcommands.String() + `  esac
+}
+
+_doglog_flags() {
+  case "$1" in
+` + flags.String() + `  esac
+}
+
+_doglog_values() {
+  case "$1" in
+` + values.String() + `  esac
+}
+
+_doglog() {
+  local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" path="" word kind i
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    word="${COMP_WORDS[i]}"
+    if [[ " $(_doglog_subcommands "$path") " == *" $word "* ]]; then
+      path="${path:+$path }$word"
+    fi
+  done
+
+  case "$prev" in
+    ` + files.String() + `)
+      COMPREPLY=($(compgen -f -- "$cur"))
+      return ;;
+  esac
+  kind="$(_doglog_values "$prev")"
+  if [[ -n "$kind" ]]; then
+    local IFS=$'\n'
+    COMPREPLY=($(compgen -W "$(doglog completion --list "$kind" 2>/dev/null)" -- "$cur"))
+    return
+  fi
+  # Without a subcommand the flags are those of search, the default subcommand
+  if [[ "$cur" == -* ]]; then
+    COMPREPLY=($(compgen -W "$(_doglog_flags "${path:-search}")" -- "$cur"))
+  else
+    COMPREPLY=($(compgen -W "$(_doglog_subcommands "$path")" -- "$cur"))
+  fi
+}
+
+complete -F _doglog doglog
+`
+}
+
+// Generate the fish completion script.
+func fishCompletion(root *argparse.Command) string {
+	var b strings.Builder
+	b.WriteString("# doglog completion for fish, e.g. 'doglog completion fish > ~/.config/fish/completions/doglog.fish'\n")
+	b.WriteString("complete -c doglog -f\n")
+	for _, p := range completionPaths(root) {
+		condition := "__fish_use_subcommand"
+		if len(p.path) > 0 {
+			words := strings.Fields(p.path)
+			condition = "__fish_seen_subcommand_from " + words[len(words)-1]
+			if p.cmd.GetParent() == root {
+				// Don't offer the flags of a command after another command with the same flag names
+				condition += "; and not __fish_seen_subcommand_from " + strings.Join(siblingNames(root, p.cmd), " ")
+			}
+			if p.path == SearchCommand {
+				// Without a subcommand the flags are those of search, the default subcommand
+				condition = "not __fish_seen_subcommand_from " + strings.Join(siblingNames(root, p.cmd), " ")
+			}
+		}
+		for _, child := range p.cmd.GetCommands() {
+			_, _ = fmt.Fprintf(&b, "complete -c doglog -n '%s' -a %s -d %s\n", fishCondition(p), child.GetName(), fishQuote(firstSentence(child.GetDescription())))
+		}
+		for _, word := range completionWords(p.cmd, p.path) {
+			if !isCommandName(p.cmd, word) {
+				_, _ = fmt.Fprintf(&b, "complete -c doglog -n '%s' -a %s\n", condition, word)
+			}
+		}
+		if p.cmd == root {
+			continue
+		}
+		for _, arg := range p.cmd.GetArgs() {
+			if arg.GetPositional() {
+				continue
+			}
+			_, _ = fmt.Fprintf(&b, "complete -c doglog -n '%s'", condition)
+			if len(arg.GetSname()) > 0 {
+				_, _ = fmt.Fprintf(&b, " -s %s", arg.GetSname())
+			}
+			_, _ = fmt.Fprintf(&b, " -l %s", arg.GetLname())
+			b.WriteString(fishValues(arg))
+			if opts := arg.GetOpts(); opts != nil {
+				_, _ = fmt.Fprintf(&b, " -d %s", fishQuote(firstSentence(opts.Help)))
+			}
+			b.WriteString("\n")
+		}
+	}
+	for _, arg := range root.GetArgs() {
+		_, _ = fmt.Fprintf(&b, "complete -c doglog -l %s", arg.GetLname())
+		if len(arg.GetSname()) > 0 {
+			_, _ = fmt.Fprintf(&b, " -s %s", arg.GetSname())
+		}
+		b.WriteString(fishValues(arg))
+		if opts := arg.GetOpts(); opts != nil {
+			_, _ = fmt.Fprintf(&b, " -d %s", fishQuote(firstSentence(opts.Help)))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// The condition under which the subcommands of a command are offered: right after the command.
+func fishCondition(p completionPath) string {
+	if len(p.path) == 0 {
+		return "__fish_use_subcommand"
+	}
+	var names []string
+	for _, child := range p.cmd.GetCommands() {
+		names = append(names, child.GetName())
+	}
+	words := strings.Fields(p.path)
+	return "__fish_seen_subcommand_from " + words[len(words)-1] + "; and not __fish_seen_subcommand_from " + strings.Join(names, " ")
+}
+
+// The names of the other commands at the same level.
+func siblingNames(root *argparse.Command, cmd *argparse.Command) []string {
+	var names []string
+	for _, child := range root.GetCommands() {
+		if child != cmd {
+			names = append(names, child.GetName())
+		}
+	}
+	return names
+}
+
+// Check whether a word is the name of a subcommand.
+func isCommandName(cmd *argparse.Command, word string) bool {
+	for _, child := range cmd.GetCommands() {
+		if child.GetName() == word {
+			return true
+		}
+	}
+	return false
+}
+
+// The first sentence of a help text, used as the description of a completion.
+func firstSentence(text string) string {
+	if i := strings.Index(text, ". "); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSuffix(text, ".")
+}
+
+// Quote a string for fish.
+func fishQuote(text string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(text, `\`, `\\`), "'", `\'`) + "'"
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"doglog/config"
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/akamensky/argparse"
+	"os"
+	"strings"
+)
+
+// The 'config' subcommands.
+type configCommands struct {
+	cmd    *argparse.Command
+	check  *argparse.Command
+	init   *argparse.Command
+	verify *bool
+}
+
+// Add the 'config' subcommands to the parser.
+func addConfigCommands(parser *argparse.Parser) *configCommands {
+	c := &configCommands{}
+	c.cmd = parser.NewCommand(ConfigCommand, "Manage the doglog configuration file.")
+	c.check = c.cmd.NewCommand("check", "Validate the configuration file: unknown sections and keys, missing keys, format templates and field mappings.")
+	c.verify = c.check.Flag("", "verify", &argparse.Options{Required: false, Help: "Also verify the api and application keys with Datadog."})
+	c.init = c.cmd.NewCommand("init", "Interactively create a new configuration file. Creates ~/.doglog unless -c is given.")
+	return c
+}
+
+// Check whether a 'config' subcommand was given.
+func (c *configCommands) happened() bool {
+	return c.cmd.Happened()
+}
+
+// Run the 'config' subcommand that was given and return the exit code.
+func (c *configCommands) run(opts *options.Options) int {
+	switch {
+	case c.check.Happened():
+		return CommandConfigCheck(opts, *c.verify)
+	case c.init.Happened():
+		path := opts.ConfigPath
+		if len(path) == 0 {
+			path = defaultConfigFile()
+		}
+		return CommandConfigInit(path)
+	}
+	return 0
+}
+
+// CommandConfigCheck Validate the configuration file and print the problems found. Returns the exit code: 1 when
+// there are errors, 0 otherwise.
+func CommandConfigCheck(opts *options.Options, verify bool) int {
+	paths, err := configPaths(opts.ConfigPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	conf, err := config.New(paths...)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	opts.ServerConfig = conf
+
+	fmt.Printf("Checking %s\n", strings.Join(conf.Paths(), ", "))
+	errors := 0
+	problems := conf.Check()
+	for _, p := range problems {
+		fmt.Println(p)
+		if p.Level == config.ProblemError {
+			errors++
+		}
+	}
+
+	if verify && errors == 0 {
+		if err := verifyKeys(opts); err != nil {
+			fmt.Printf("%s: %s\n", config.ProblemError, err)
+			errors++
+		} else {
+			fmt.Println("The api and application keys were accepted by Datadog")
+		}
+	}
+
+	if len(problems) == 0 && errors == 0 {
+		fmt.Println("No problems found")
+	}
+	if errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Verify the api key, then verify the application key by requesting a single log message.
+func verifyKeys(opts *options.Options) error {
+	ctx := constructDatadogContext(opts)
+	client := apiClient(opts)
+
+	if _, _, err := datadogV1.NewAuthenticationApi(client).Validate(ctx); err != nil {
+		return fmt.Errorf("the api key was rejected - %s", err)
+	}
+
+	body := datadogV2.LogsListRequest{
+		Filter: &datadogV2.LogsQueryFilter{
+			From: datadog.PtrString("now-1m"),
+			To:   datadog.PtrString("now"),
+		},
+		Page: &datadogV2.LogsListRequestPage{
+			Limit: datadog.PtrInt32(1),
+		},
+	}
+	if _, _, err := datadogV2.NewLogsApi(client).ListLogs(ctx, *datadogV2.NewListLogsOptionalParameters().WithBody(body)); err != nil {
+		return fmt.Errorf("the application key was rejected - %s", err)
+	}
+	return nil
+}
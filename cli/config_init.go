@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"bufio"
+	"doglog/config"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Permissions of the configuration file. It contains the api keys so only the user may read it.
+const configFileMode = 0600
+
+// A simple line-based prompter for the interactive commands.
+type prompter struct {
+	in *bufio.Reader
+}
+
+// CommandConfigInit Interactively create a configuration file. Returns the exit code.
+func CommandConfigInit(configPath string) int {
+	p := prompter{in: bufio.NewReader(os.Stdin)}
+
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Config file path is invalid: %s\n", err)
+		return 1
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		if !p.confirm(fmt.Sprintf("%s already exists. Overwrite it?", configPath), false) {
+			return 1
+		}
+	}
+
+	var settings config.Settings
+	sites := config.KnownSites()
+	fmt.Println("Which Datadog site do you use?")
+	settings.Site = sites[p.choose(sites, 0)]
+
+	fmt.Println("How should doglog get your Datadog api and application keys?")
+	if p.choose([]string{"Store the keys in the configuration file", "Run a command that prints each key (e.g. a password manager)"}, 0) == 0 {
+		settings.ApiKey = p.secret("Api key")
+		settings.ApplicationKey = p.secret("Application key")
+	} else {
+		settings.ApiKeyCommand = p.ask("Command that prints the api key", "")
+		settings.ApplicationKeyCommand = p.ask("Command that prints the application key", "")
+	}
+
+	fmt.Println("Which starter formats do you want?")
+	for _, pack := range config.FormatPacks() {
+		if p.confirm(fmt.Sprintf("  %s?", pack.Description), pack.Name == "java") {
+			settings.Packs = append(settings.Packs, pack.Name)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't create %s: %s\n", filepath.Dir(configPath), err)
+		return 1
+	}
+	if err := os.WriteFile(configPath, []byte(config.Generate(settings)), configFileMode); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't write %s: %s\n", configPath, err)
+		return 1
+	}
+	// WriteFile doesn't change the permissions of an existing file
+	if err := os.Chmod(configPath, configFileMode); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't change the permissions of %s: %s\n", configPath, err)
+		return 1
+	}
+
+	fmt.Printf("Wrote %s. Run 'doglog config check' to validate it.\n", configPath)
+	return 0
+}
+
+// Ask a question and return the answer, or the default when the answer is empty.
+func (p prompter) ask(question string, defaultValue string) string {
+	if len(defaultValue) > 0 {
+		fmt.Printf("%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+	answer, err := p.in.ReadString('\n')
+	if err != nil && len(answer) == 0 {
+		fmt.Println()
+		os.Exit(1)
+	}
+	answer = strings.TrimSpace(answer)
+	if len(answer) == 0 {
+		return defaultValue
+	}
+	return answer
+}
+
+// Ask a yes/no question.
+func (p prompter) confirm(question string, defaultValue bool) bool {
+	hint := "y/N"
+	if defaultValue {
+		hint = "Y/n"
+	}
+	for {
+		switch strings.ToLower(p.ask(question+" ("+hint+")", "")) {
+		case "":
+			return defaultValue
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// Ask the user to pick one of a list of choices and return its index.
+func (p prompter) choose(choices []string, defaultChoice int) int {
+	for i, c := range choices {
+		fmt.Printf("  %d) %s\n", i+1, c)
+	}
+	for {
+		answer := p.ask("Choice", strconv.Itoa(defaultChoice+1))
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+			return n - 1
+		}
+	}
+}
+
+// Ask for a secret value without echoing it when reading from a terminal.
+func (p prompter) secret(question string) string {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return p.ask(question, "")
+	}
+	fmt.Printf("%s: ", question)
+	value, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		os.Exit(1)
+	}
+	return strings.TrimSpace(string(value))
+}
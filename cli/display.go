@@ -9,7 +9,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
-	"github.com/Masterminds/sprig/v3"
 	"strconv"
 	"strings"
 	"text/template"
@@ -18,7 +17,13 @@ import (
 
 // Format a log message into JSON.
 func formatJson(msg datadogV2.Log) (text string) {
-	buf, _ := json.Marshal(msg.AdditionalProperties)
+	fields := make(map[string]interface{}, len(msg.AdditionalProperties))
+	for k, v := range msg.AdditionalProperties {
+		if !isTemplateField(k, v) {
+			fields[k] = v
+		}
+	}
+	buf, _ := json.Marshal(fields)
 	text = strings.TrimRight(string(buf), "}")
 	buf, _ = json.Marshal(msg.GetAttributes().Tags)
 	text += ",\"tags\":"
@@ -30,6 +35,58 @@ func formatJson(msg datadogV2.Log) (text string) {
 	return
 }
 
+// The fields holding color escapes. They are only meaningful to the format templates.
+var colorFields = []string{
+	consts.LevelColorField, consts.BlueField, consts.RedField, consts.GreenField, consts.YellowField,
+	consts.GreyField, consts.WhiteField, consts.CyanField, consts.MagentaField, consts.ResetField,
+}
+
+// Check whether a field holds a color escape.
+func isColorField(field string) bool {
+	for _, f := range colorFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a field is only meant for the format templates: the nested attributes, e.g. http for
+// {{.http.method}}, and the typed values of the mapped fields. The JSON output already has them as flattened fields.
+func isTemplateField(field string, value interface{}) bool {
+	if field == consts.ComputedTypedField {
+		return true
+	}
+	_, nested := value.(map[string]interface{})
+	return nested
+}
+
+// Encode a normalized log message as a single line of JSON, leaving out the color escapes and the
+// pre-formatted json field. The nested attributes are there under their flattened names, as used by the templates,
+// and under their full dotted path too, e.g. method and http.method, so the message can be read back by
+// 'doglog formats test --input'.
+func messageJson(msg datadogV2.Log) []byte {
+	fields := make(map[string]interface{}, len(msg.AdditionalProperties))
+	for k, v := range msg.AdditionalProperties {
+		if isColorField(k) || k == consts.ComputedJsonField || isTemplateField(k, v) {
+			continue
+		}
+		fields[k] = v
+	}
+	if msg.Attributes != nil {
+		paths := make(map[string]interface{})
+		attributePaths(msg.Attributes.Attributes, "", paths)
+		for path, v := range paths {
+			if _, exists := fields[path]; !exists {
+				fields[path] = v
+			}
+		}
+	}
+	fields["tags"] = msg.GetAttributes().Tags
+	buf, _ := json.Marshal(fields)
+	return buf
+}
+
 // Print a single log message to stdout.
 func printMessage(opts *options.Options, msg *datadogV2.Log) {
 	adjustMap(opts, msg)
@@ -37,11 +94,13 @@ func printMessage(opts *options.Options, msg *datadogV2.Log) {
 	var text string
 
 	jsonField := msg.AdditionalProperties[consts.ComputedJsonField]
-	if opts.OutputJson && jsonField != nil {
-		text = jsonField.(string)
+	if opts.OutputJson {
+		text = string(messageJson(*msg))
 	} else {
-		for _, f := range opts.ServerConfig.Formats(opts.UseLong) {
-			text = tryFormat(opts, *msg, f.Name, f.Format)
+		attributes := msg.GetAttributes()
+		formats := opts.ServerConfig.MessageFormats(opts.UseLong, attributes.GetService(), messageSource(*msg), attributes.Tags)
+		for _, f := range formats {
+			text, _ = tryFormat(opts, *msg, f.Name, f.Format)
 			if len(text) > 0 {
 				break
 			}
@@ -63,19 +122,72 @@ func printMessage(opts *options.Options, msg *datadogV2.Log) {
 	}
 }
 
-// Try to apply a format template and return an empty string if the format failed.
-func tryFormat(opts *options.Options, msg datadogV2.Log, tmplName string, tmpl string) string {
-	var t = template.Must(template.New(tmplName).Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(tmpl))
+// Find the source of a message (e.g. nginx, java) in its 'source' tag, or in its source attributes.
+func messageSource(msg datadogV2.Log) string {
+	for _, tag := range msg.GetAttributes().Tags {
+		if source, ok := strings.CutPrefix(tag, "source:"); ok {
+			return source
+		}
+	}
+	for _, field := range []string{"source", "ddsource"} {
+		if source := getField(msg.AdditionalProperties, field); len(source) > 0 {
+			return source
+		}
+	}
+	return ""
+}
+
+// Compiled templates, by template text, so each one is only parsed once.
+var compiledTemplates = make(map[string]*template.Template)
+
+// Parse a template, or return the error that prevents it from being parsed.
+func compileTemplate(tmplName string, tmpl string) (*template.Template, error) {
+	if t, ok := compiledTemplates[tmpl]; ok {
+		return t, nil
+	}
+	t, err := config.ParseTemplate(tmplName, tmpl)
+	if err != nil {
+		return nil, err
+	}
+	compiledTemplates[tmpl] = t
+	return t, nil
+}
+
+// Try to apply a format template and return an empty string, with the reason, if the format failed.
+func tryFormat(opts *options.Options, msg datadogV2.Log, tmplName string, tmpl string) (string, error) {
+	t, err := compileTemplate(tmplName, tmpl)
+	if err != nil {
+		log.Error(*opts, "failed to parse template '%s' (run 'doglog config check' for details): %v", tmplName, err)
+		return "", err
+	}
 	var result bytes.Buffer
 
-	err := t.Execute(&result, msg.AdditionalProperties)
+	err = t.Execute(&result, msg.AdditionalProperties)
 	if err == nil {
 		log.Info(*opts, "Applied template '%s' successfully", tmplName)
-		return result.String()
+		return result.String(), nil
 	}
 	log.Debug(*opts, "failed to apply template '%s': %v", tmplName, err)
 
-	return ""
+	return "", err
+}
+
+// Evaluate the computed fields from the [computed] section, in order, so each one can use the ones before it. A field
+// whose template can't be applied to the message is left unset.
+func computeFields(opts *options.Options, msg *datadogV2.Log) {
+	for _, f := range opts.ServerConfig.ComputedFields() {
+		t, err := compileTemplate(f.Name, f.Format)
+		if err != nil {
+			log.Error(*opts, "failed to parse computed field '%s' (run 'doglog config check' for details): %v", f.Name, err)
+			continue
+		}
+		var result bytes.Buffer
+		if err := t.Execute(&result, msg.AdditionalProperties); err != nil {
+			log.Debug(*opts, "failed to compute field '%s': %v", f.Name, err)
+			continue
+		}
+		msg.AdditionalProperties[f.Name] = result.String()
+	}
 }
 
 // Collapse a tree of maps into a single top-level map.
@@ -94,15 +206,59 @@ func flatten(src map[string]interface{}, dest map[string]interface{}) {
 	}
 }
 
+// Collect the attributes of a message by their full dotted path, e.g. http.request.method, which is what the [fields]
+// mappings use. List elements are numbered, e.g. tags.0.
+func attributePaths(attributes map[string]interface{}, prefix string, dest map[string]interface{}) {
+	for k, v := range attributes {
+		path := prefix + k
+		switch child := v.(type) {
+		case map[string]interface{}:
+			attributePaths(child, path+".", dest)
+		case []interface{}:
+			for i := range child {
+				item := path + "." + strconv.Itoa(i)
+				if m, ok := child[i].(map[string]interface{}); ok {
+					attributePaths(m, item+".", dest)
+				} else {
+					dest[item] = child[i]
+				}
+			}
+		default:
+			dest[path] = v
+		}
+	}
+}
+
+// The key of an attribute in the flattened message: its last name, e.g. method for http.request.method, with the
+// number of list elements, e.g. ids.0 for request.ids.0.
+func flattenedKey(path string) string {
+	parts := strings.Split(path, ".")
+	last := parts[len(parts)-1]
+	if _, err := strconv.Atoi(last); err == nil && len(parts) > 1 {
+		return parts[len(parts)-2] + "." + last
+	}
+	return last
+}
+
 // Normalize the log message and add helper fields.
 func adjustMap(opts *options.Options, msg *datadogV2.Log) {
-	useColor := opts.UseColor
+	if _, adjusted := msg.AdditionalProperties[consts.ComputedJsonField]; adjusted {
+		return
+	}
 	if msg.AdditionalProperties == nil {
 		msg.AdditionalProperties = make(map[string]interface{})
 	}
 	additionalProperties := &msg.AdditionalProperties
 	if msg.Attributes.Attributes != nil {
 		flatten(msg.Attributes.Attributes, msg.AdditionalProperties)
+		// Keep the nested attributes too, so templates can use paths such as {{.http.method}}
+		for k, v := range msg.Attributes.Attributes {
+			if _, ok := v.(map[string]interface{}); ok {
+				if _, exists := msg.AdditionalProperties[k]; !exists {
+					msg.AdditionalProperties[k] = v
+				}
+			}
+		}
 	}
 	if msg.Attributes.Status != nil {
 		(*additionalProperties)[consts.DatadogStatus] = msg.Attributes.Status
@@ -122,10 +278,9 @@ func adjustMap(opts *options.Options, msg *datadogV2.Log) {
 
 	opts.ServerConfig.AggregateFields(*msg)
 
-	if rpf := (*additionalProperties)[consts.RequestPageField]; rpf != nil {
-		requestPage := rpf.(string)
-		if len(requestPage) > 1 && !strings.HasPrefix(requestPage, "/") {
-			rpf = "/" + requestPage
+	if requestPage := getField(msg.AdditionalProperties, consts.RequestPageField); len(requestPage) > 1 {
+		if !strings.HasPrefix(requestPage, "/") {
+			(*additionalProperties)[consts.RequestPageField] = "/" + requestPage
 		}
 	}
 	classname := getField(msg.AdditionalProperties, consts.ComputedClassNameField)
@@ -133,36 +288,33 @@ func adjustMap(opts *options.Options, msg *datadogV2.Log) {
 		(*additionalProperties)[consts.ComputedShortClassnameField] = createShortClassname(classname)
 	}
 
-	level := normalizeLevel(*msg)
+	if link := messageUrl(opts, *msg); len(link) > 0 {
+		(*additionalProperties)[consts.ComputedUrlField] = link
+	}
+
+	level := normalizeLevel(opts, *msg)
 	(*additionalProperties)[consts.ComputedLevelField] = level
 
 	constructMessageText(*msg)
 
+	computeFields(opts, msg)
+
 	msg.AdditionalProperties[consts.ComputedJsonField] = formatJson(*msg)
 
-	setupColors(useColor, level, *msg)
+	setupColors(opts, level, *msg)
 }
 
-// Extract a named entry from a map, returning an empty string if not found.
+// Extract a named entry from a map, returning an empty string if not found. Non-string values are converted to
+// strings.
 func getField(props map[string]interface{}, field string) string {
-	if value, ok := props[field]; ok {
-		switch v := value.(type) {
-		case string:
-			return v
-		case *string:
-			return *v
-		default:
-			return ""
-		}
-	} else {
-		return ""
-	}
+	value, _ := config.FieldString(props[field])
+	return value
 }
 
 // Set up the colors in the message structure.
-func setupColors(useColor bool, level string, msg datadogV2.Log) {
-	if useColor {
-		computeLevelColor(level, msg)
+func setupColors(opts *options.Options, level string, msg datadogV2.Log) {
+	if opts.UseColor {
+		computeLevelColor(opts, level, msg)
 		// Add color escapes
 		msg.AdditionalProperties[consts.BlueField] = consts.BlueEsc
 		msg.AdditionalProperties[consts.RedField] = consts.RedEsc
@@ -197,49 +349,16 @@ func constructMessageText(msg datadogV2.Log) {
 	msg.AdditionalProperties[consts.ComputedMessageField] = messageText
 }
 
-// Normalize the "level" of the message.
-func normalizeLevel(msg datadogV2.Log) (level string) {
-	if status := msg.GetAttributes().Status; status == nil {
-		level = getField(msg.AdditionalProperties, consts.ComputedLevelField)
-	} else {
-		level = *status
-	}
-	level = strings.ToUpper(level)
-	if strings.HasPrefix(level, "E") {
-		level = consts.ErrorLevel
-	} else if strings.HasPrefix(level, "F") {
-		level = consts.FatalLevel
-	} else if strings.HasPrefix(level, "I") {
-		level = consts.InfoLevel
-	} else if strings.HasPrefix(level, "W") {
-		level = consts.WarnLevel
-	} else if strings.HasPrefix(level, "D") {
-		level = consts.DebugLevel
-	} else if strings.HasPrefix(level, "T") {
-		level = consts.TraceLevel
-	}
+// Normalize the "level" of the message using the level mappings, e.g. 'warning' and '40' become WARN.
+func normalizeLevel(opts *options.Options, msg datadogV2.Log) string {
+	level := opts.ServerConfig.Levels().Normalize(getField(msg.AdditionalProperties, consts.ComputedLevelField))
 	msg.AdditionalProperties[consts.ComputedLevelField] = level
-	return
+	return level
 }
 
 // Compute the color that should be used to display the log level in the message output.
-func computeLevelColor(level string, msg datadogV2.Log) {
-	var levelColor string
-	switch level {
-	case consts.DebugLevel, consts.TraceLevel:
-		levelColor = consts.DebugEsc
-	case consts.InfoLevel:
-		levelColor = consts.InfoEsc
-	case consts.WarnLevel:
-		levelColor = consts.WarnEsc
-	case consts.ErrorLevel, consts.FatalLevel:
-		levelColor = consts.ErrorEsc
-	}
-	if len(levelColor) > 0 {
-		msg.AdditionalProperties[consts.LevelColorField] = levelColor
-	} else {
-		msg.AdditionalProperties[consts.LevelColorField] = ""
-	}
+func computeLevelColor(opts *options.Options, level string, msg datadogV2.Log) {
+	msg.AdditionalProperties[consts.LevelColorField] = opts.ServerConfig.Levels().Color(level)
 }
 
 // Create a shortened version of the Java classname.
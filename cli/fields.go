@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"doglog/config"
+	"doglog/consts"
+	"doglog/log"
+	"doglog/options"
+	"encoding/json"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/akamensky/argparse"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// DefaultSample is the number of messages sampled when no limit is provided by the user
+const DefaultSample = 100
+
+// The flags of the fields subcommand.
+type fieldsFlags struct {
+	scope *scopeFlags
+	end   *string
+	limit *int
+	json  *bool
+}
+
+// Add the flags of the fields subcommand.
+func addFieldsFlags(cmd *argparse.Command) *fieldsFlags {
+	return &fieldsFlags{
+		scope: addScopeFlags(cmd),
+		end:   addEndFlag(cmd),
+		limit: cmd.Int("l", "limit", &argparse.Options{Required: false, Help: "The number of messages to sample, at most 1000", Default: DefaultSample}),
+		json:  cmd.Flag("j", "json", &argparse.Options{Required: false, Help: "Output one json object per field."}),
+	}
+}
+
+// Copy the fields flags into the options.
+func (f *fieldsFlags) apply(opts *options.Options) {
+	f.scope.apply(opts)
+	opts.EndDate = *f.end
+	opts.Limit = *f.limit
+	opts.OutputJson = *f.json
+}
+
+// Fetch a single page of the most recent log messages that match the search criteria.
+func sampleMessages(opts *options.Options) ([]datadogV2.Log, error) {
+	limit := opts.Limit
+	if limit > 1000 {
+		limit = 1000
+	}
+	body := datadogV2.LogsListRequest{
+		Filter: &datadogV2.LogsQueryFilter{
+			Query:   &opts.Query,
+			From:    &opts.StartDate,
+			To:      &opts.EndDate,
+			Indexes: opts.Indexes,
+		},
+		Options: &datadogV2.LogsQueryOptions{
+			Timezone: datadog.PtrString("UTC"),
+		},
+		Page: &datadogV2.LogsListRequestPage{
+			Limit: datadog.PtrInt32(int32(limit)),
+		},
+		Sort: datadogV2.LOGSSORT_TIMESTAMP_DESCENDING.Ptr(),
+	}
+
+	ctx := constructDatadogContext(opts)
+	resp, _, err := datadogV2.NewLogsApi(apiClient(opts)).ListLogs(ctx, *datadogV2.NewListLogsOptionalParameters().WithBody(body))
+	if err != nil {
+		log.Error(*opts, "Error when calling `LogsApi.ListLogs`: %v", err)
+		return nil, apiError(err)
+	}
+	return resp.Data, nil
+}
+
+// The number of example values shown for each field.
+const fieldExamples = 3
+
+// The longest example value shown, longer values are truncated.
+const exampleWidth = 40
+
+// What was learned about a single field of the sampled messages.
+type fieldReport struct {
+	Name     string   `json:"name"`
+	Types    []string `json:"types"`
+	Count    int      `json:"count"`
+	Fill     float64  `json:"fill"`
+	Examples []string `json:"examples"`
+	Feeds    []string `json:"feeds,omitempty"`
+}
+
+// Add a value of the field to the report.
+func (r *fieldReport) add(value interface{}) {
+	r.Count++
+	if t := fieldType(value); !containsString(r.Types, t) {
+		r.Types = append(r.Types, t)
+	}
+	if example, ok := config.FieldString(value); ok && len(r.Examples) < fieldExamples {
+		if runes := []rune(example); len(runes) > exampleWidth {
+			example = string(runes[:exampleWidth-3]) + "..."
+		}
+		if !containsString(r.Examples, example) {
+			r.Examples = append(r.Examples, example)
+		}
+	}
+}
+
+// The JSON type of a field value.
+func fieldType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string, *string:
+		return "string"
+	case bool:
+		return "bool"
+	case float32, float64, int, int32, int64, json.Number:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// Describe the fields of the sampled messages: their types, how often they're filled, a few values and the
+// computed fields they feed through the [fields] mappings. Attributes are named by their full dotted path.
+func reportFields(opts *options.Options, messages []datadogV2.Log) []*fieldReport {
+	reports := make(map[string]*fieldReport)
+	report := func(name string) *fieldReport {
+		if r, ok := reports[name]; ok {
+			return r
+		}
+		r := &fieldReport{Name: name}
+		reports[name] = r
+		return r
+	}
+
+	mappings := opts.ServerConfig.Fields()
+	for i := range messages {
+		msg := &messages[i]
+		adjustMap(opts, msg)
+
+		paths := make(map[string]interface{})
+		if msg.Attributes != nil {
+			attributePaths(msg.Attributes.Attributes, "", paths)
+		}
+		// The flattened attributes are only known by their last name, e.g. method for http.request.method
+		byName := make(map[string][]string)
+		for path := range paths {
+			name := flattenedKey(path)
+			byName[name] = append(byName[name], path)
+		}
+
+		// A field is counted once per message
+		seen := make(map[string]bool)
+		add := func(name string, value interface{}) {
+			if !seen[name] {
+				seen[name] = true
+				report(name).add(value)
+			}
+		}
+		for path, v := range paths {
+			add(path, v)
+		}
+		for k, v := range msg.AdditionalProperties {
+			if _, flattened := byName[k]; flattened || isTemplateField(k, v) || isColorField(k) || k == consts.ComputedJsonField {
+				continue
+			}
+			add(k, v)
+		}
+
+		for target := range mappings {
+			source, _, ok := opts.ServerConfig.MappedSource(*msg, target)
+			if !ok || source == target {
+				continue
+			}
+			sources := byName[source]
+			if _, ok := paths[source]; ok || len(sources) == 0 {
+				sources = []string{source}
+			}
+			for _, path := range sources {
+				if r, ok := reports[path]; ok && !containsString(r.Feeds, target) {
+					r.Feeds = append(r.Feeds, target)
+				}
+			}
+		}
+	}
+
+	result := make([]*fieldReport, 0, len(reports))
+	for _, r := range reports {
+		r.Fill = float64(r.Count) / float64(len(messages))
+		sort.Strings(r.Types)
+		sort.Strings(r.Feeds)
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// CommandFields List the fields found in a sample of the log messages that match the search criteria, with their
+// types, fill rates, example values and the computed fields they feed. Returns the exit code.
+func CommandFields(opts *options.Options) int {
+	messages, err := sampleMessages(opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't sample the log messages - %s\n", err)
+		return 1
+	}
+	if len(messages) == 0 {
+		fmt.Println("No log messages found.")
+		return 0
+	}
+
+	reports := reportFields(opts, messages)
+	if opts.OutputJson {
+		for _, r := range reports {
+			buf, _ := json.Marshal(r)
+			fmt.Println(string(buf))
+		}
+		return 0
+	}
+
+	fmt.Printf("%d fields in %d messages\n", len(reports), len(messages))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FIELD\tTYPE\tFILL\tEXAMPLES\tFEEDS")
+	for _, r := range reports {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%.0f%%\t%s\t%s\n", r.Name, strings.Join(r.Types, "|"), r.Fill*100,
+			strings.Join(r.Examples, ", "), strings.Join(r.Feeds, ", "))
+	}
+	_ = w.Flush()
+	return 0
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bufio"
+	"doglog/config"
+	"doglog/consts"
+	"doglog/options"
+	"encoding/json"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/akamensky/argparse"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultFormatSample is the number of messages tested when no limit is provided by the user
+const DefaultFormatSample = 10
+
+// The 'formats' subcommands.
+type formatsCommands struct {
+	cmd   *argparse.Command
+	test  *argparse.Command
+	scope *scopeFlags
+	end   *string
+	limit *int
+	long  *bool
+	input *string
+}
+
+// Add the 'formats' subcommands to the parser.
+func addFormatsCommands(parser *argparse.Parser) *formatsCommands {
+	c := &formatsCommands{}
+	c.cmd = parser.NewCommand(FormatsCommand, "Work with the message formats.")
+	c.test = c.cmd.NewCommand("test", "Render log messages through every format, in order, and show which format matched each message and why the formats before it were skipped.")
+	c.scope = addScopeFlags(c.test)
+	c.end = addEndFlag(c.test)
+	c.limit = c.test.Int("l", "limit", &argparse.Options{Required: false, Help: "The number of messages to test, at most 1000", Default: DefaultFormatSample})
+	c.long = c.test.Flag("", "long", &argparse.Options{Required: false, Help: "Test the long formats instead of the short ones", Default: false})
+	c.input = c.test.String("", "input", &argparse.Options{Required: false, Help: "Read the messages from a file instead of Datadog, one JSON message per line: the output of 'doglog -j', or log messages as returned by the Datadog API. Use '-' for stdin"})
+	return c
+}
+
+// Check whether a 'formats' subcommand was given.
+func (c *formatsCommands) happened() bool {
+	return c.cmd.Happened()
+}
+
+// Copy the 'formats test' flags into the options.
+func (c *formatsCommands) apply(opts *options.Options) {
+	c.scope.apply(opts)
+	opts.EndDate = *c.end
+	opts.Limit = *c.limit
+	opts.UseLong = *c.long
+	opts.Input = *c.input
+}
+
+// CommandFormatsTest Render log messages through every format and report, for each message, the format that matched
+// and the missing key or execution error that made each earlier format fail. Returns the exit code.
+func CommandFormatsTest(opts *options.Options) int {
+	var messages []datadogV2.Log
+	var err error
+	if len(opts.Input) > 0 {
+		messages, err = readMessages(opts.Input, opts.Limit)
+	} else {
+		messages, err = sampleMessages(opts)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't read the log messages - %s\n", err)
+		return 1
+	}
+	if len(messages) == 0 {
+		fmt.Println("No log messages found.")
+		return 0
+	}
+
+	unmatched := 0
+	for i := range messages {
+		msg := &messages[i]
+		adjustMap(opts, msg)
+		attributes := msg.GetAttributes()
+		source := messageSource(*msg)
+
+		fmt.Printf("Message %d", i+1)
+		if id := msg.GetId(); len(id) > 0 {
+			fmt.Printf(" %s", id)
+		}
+		fmt.Printf(" (service '%s', source '%s')\n", attributes.GetService(), source)
+
+		matched := false
+		for _, f := range opts.ServerConfig.MessageFormats(opts.UseLong, attributes.GetService(), source, attributes.Tags) {
+			text, err := tryFormat(opts, *msg, f.Name, f.Format)
+			switch {
+			case err != nil:
+				fmt.Printf("  skipped %s: %s\n", f.Name, config.TrimTemplateError(f.Name, err))
+			case len(text) == 0:
+				fmt.Printf("  skipped %s: the format rendered an empty text\n", f.Name)
+			default:
+				fmt.Printf("  matched %s: %s\n", f.Name, text)
+				matched = true
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			fmt.Println("  no format matched, the message is printed as JSON")
+			unmatched++
+		}
+	}
+	if unmatched > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "%d of %d messages matched no format\n", unmatched, len(messages))
+	}
+	return 0
+}
+
+// Read up to limit log messages from a file of JSON lines. Each line is either a log message as returned by the Datadog
+// API, or a message written by 'doglog -j'.
+func readMessages(path string, limit int) ([]datadogV2.Log, error) {
+	file := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		file = f
+	}
+
+	var messages []datadogV2.Log
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan() && len(messages) < limit; line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 {
+			continue
+		}
+		msg, err := parseMessage([]byte(text))
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Skipping line %d of %s - %s\n", line, path, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, scanner.Err()
+}
+
+// Parse a single JSON message, either in the Datadog API layout or as written by 'doglog -j'.
+func parseMessage(line []byte) (datadogV2.Log, error) {
+	// Numbers are read as float64, like the messages from Datadog, so the templates render them the same way
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return datadogV2.Log{}, err
+	}
+	// The flattened names of the nested attributes are computed again from their dotted paths
+	flattened := make(map[string]bool)
+	for k := range fields {
+		if key := flattenedKey(k); key != k && !strings.HasPrefix(k, "__") {
+			flattened[key] = true
+		}
+	}
+
+	if _, ok := fields["attributes"].(map[string]interface{}); ok {
+		var msg datadogV2.Log
+		err := json.Unmarshal(line, &msg)
+		return msg, err
+	}
+
+	// The fields computed by doglog are computed again, using the current configuration
+	attributes := &datadogV2.LogAttributes{Attributes: make(map[string]interface{})}
+	for k, v := range fields {
+		if flattened[k] {
+			continue
+		}
+		s, _ := config.FieldString(v)
+		switch k {
+		case consts.DatadogMessage:
+			attributes.Message = datadog.PtrString(s)
+		case consts.DatadogService:
+			attributes.Service = datadog.PtrString(s)
+		case consts.DatadogHost:
+			attributes.Host = datadog.PtrString(s)
+		case consts.DatadogStatus:
+			attributes.Status = datadog.PtrString(s)
+		case consts.DatadogTimestamp:
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				attributes.Timestamp = &t
+			}
+		case "tags":
+			if tags, ok := v.([]interface{}); ok {
+				for _, tag := range tags {
+					if s, ok := tag.(string); ok {
+						attributes.Tags = append(attributes.Tags, s)
+					}
+				}
+			}
+		default:
+			setAttribute(attributes.Attributes, k, v)
+		}
+	}
+	for k, v := range attributes.Attributes {
+		attributes.Attributes[k] = restoreLists(v)
+	}
+	return datadogV2.Log{Attributes: attributes, Type: datadogV2.LOGTYPE_LOG.Ptr()}, nil
+}
+
+// Set an attribute by its dotted path, e.g. http.method, creating the nested attributes on the way. The fields
+// computed by doglog, e.g. __level, are kept as they are: they're computed again unless their source is missing.
+func setAttribute(attributes map[string]interface{}, path string, value interface{}) {
+	if strings.HasPrefix(path, "__") {
+		attributes[path] = value
+		return
+	}
+	parts := strings.Split(path, ".")
+	current := attributes
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := current[part].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			current[part] = child
+		}
+		current = child
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+// Turn the nested attributes whose names are the numbers 0 to n-1, e.g. from ids.0 and ids.1, back into lists.
+func restoreLists(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for k, v := range m {
+		m[k] = restoreLists(v)
+	}
+	list := make([]interface{}, len(m))
+	for k, v := range m {
+		i, err := strconv.Atoi(k)
+		if err != nil || i < 0 || i >= len(m) || strconv.Itoa(i) != k {
+			return m
+		}
+		list[i] = v
+	}
+	if len(list) == 0 {
+		return m
+	}
+	return list
+}
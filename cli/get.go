@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"doglog/log"
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/akamensky/argparse"
+	"os"
+	"time"
+)
+
+// The range searched for a message by id when no --start is provided by the user.
+const defaultGetRange = "now-15d"
+
+// The flags of the get subcommand.
+type getFlags struct {
+	id      *string
+	indexes *[]string
+	start   *string
+	end     *string
+	json    *bool
+	long    *bool
+}
+
+// Add the flags of the get subcommand.
+func addGetFlags(cmd *argparse.Command) *getFlags {
+	return &getFlags{
+		id:      cmd.StringPositional(&argparse.Options{Help: "The id of the log message, e.g., from the JSON output or a Log Explorer link"}),
+		indexes: cmd.StringList("i", "indices", &argparse.Options{Required: false, Help: "The index to search in Datadog. Only the first index is used", Default: defaultIndices}),
+		start:   cmd.String("", "start", &argparse.Options{Required: false, Help: "Starting date/time to search for the message from. Defaults to 15 days ago", Default: defaultGetRange}),
+		end:     cmd.String("", "end", &argparse.Options{Required: false, Help: endHelp, Default: "now"}),
+		json:    cmd.Flag("j", "json", &argparse.Options{Required: false, Help: "Output the message in json format."}),
+		long:    cmd.Flag("", "long", &argparse.Options{Required: false, Help: "Generate long output", Default: false}),
+	}
+}
+
+// Copy the get flags into the options.
+func (f *getFlags) apply(opts *options.Options) {
+	opts.LogId = *f.id
+	opts.Indexes = *f.indexes
+	opts.StartDate = *f.start
+	opts.EndDate = *f.end
+	opts.OutputJson = *f.json
+	opts.UseLong = *f.long
+}
+
+// CommandGet Display a single log message by its id. Returns the exit code.
+func CommandGet(opts *options.Options) int {
+	if len(opts.LogId) == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "The id of the log message is required")
+		return 1
+	}
+	msg, err := getMessage(opts, opts.LogId)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't get the log message %s - %s\n", opts.LogId, err)
+		return 1
+	}
+	printMessage(opts, msg)
+	return 0
+}
+
+// Fetch a single log message by its id. The v2 API can't look up a message by id, so the v1 list is started at the
+// message and only the first message is kept.
+func getMessage(opts *options.Options, id string) (*datadogV2.Log, error) {
+	now := time.Now()
+	from, err := resolveTime(opts.StartDate, now)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolveTime(opts.EndDate, now)
+	if err != nil {
+		return nil, err
+	}
+
+	body := datadogV1.LogsListRequest{
+		Limit:   datadog.PtrInt32(1),
+		StartAt: datadog.PtrString(id),
+		Time:    datadogV1.LogsListRequestTime{From: from, To: to},
+		Sort:    datadogV1.LOGSSORT_TIME_DESCENDING.Ptr(),
+	}
+	if len(opts.Indexes) > 0 {
+		body.Index = datadog.PtrString(opts.Indexes[0])
+	}
+
+	ctx := constructDatadogContext(opts)
+	resp, _, err := datadogV1.NewLogsApi(apiClient(opts)).ListLogs(ctx, body)
+	if err != nil {
+		log.Error(*opts, "Error when calling `LogsApi.ListLogs`: %v", err)
+		return nil, apiError(err)
+	}
+	for _, l := range resp.Logs {
+		if l.GetId() == id && l.Content != nil {
+			return convertMessage(l), nil
+		}
+	}
+	return nil, fmt.Errorf("not found in index %s between %s and %s", body.GetIndex(), from.Format(time.RFC3339), to.Format(time.RFC3339))
+}
+
+// Convert a v1 log message into the v2 message used everywhere else.
+func convertMessage(l datadogV1.Log) *datadogV2.Log {
+	content := l.Content
+	attributes := &datadogV2.LogAttributes{
+		Attributes: content.Attributes,
+		Host:       content.Host,
+		Message:    content.Message,
+		Service:    content.Service,
+		Tags:       content.Tags,
+		Timestamp:  content.Timestamp,
+	}
+	if status, ok := content.Attributes["status"].(string); ok {
+		attributes.Status = datadog.PtrString(status)
+	}
+	return &datadogV2.Log{Id: l.Id, Attributes: attributes, Type: datadogV2.LOGTYPE_LOG.Ptr()}
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"doglog/config"
+	"doglog/consts"
+	"doglog/log"
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadog"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"time"
+)
+
+// Number of time buckets (rows) in the histogram.
+const histogramBuckets = 20
+
+// Terminal width used when the real width can't be determined.
+const defaultTerminalWidth = 80
+
+// Width of the bucket count column.
+const histogramCountWidth = 7
+
+// histogramLevel describes how a group of normalized levels is drawn in the histogram.
+type histogramLevel struct {
+	Name string
+	// The least severe level in the group. The group holds every level from this one up to the next group's level.
+	Min    string
+	Color  string
+	Symbol string
+}
+
+// The level groups, from most to least severe, in the order they are drawn. Anything that doesn't match falls into
+// the last group.
+var histogramLevels = []histogramLevel{
+	{Name: consts.ErrorLevel, Min: consts.ErrorLevel, Color: consts.ErrorEsc, Symbol: "#"},
+	{Name: consts.WarnLevel, Min: consts.WarnLevel, Color: consts.WarnEsc, Symbol: "="},
+	{Name: consts.InfoLevel, Min: consts.InfoLevel, Color: consts.InfoEsc, Symbol: "-"},
+	{Name: consts.DebugLevel, Min: consts.TraceLevel, Color: consts.DebugEsc, Symbol: "."},
+	{Name: "OTHER", Color: consts.GreyEsc, Symbol: "?"},
+}
+
+// The facet the messages are counted by, Datadog's normalized status.
+const histogramFacet = "status"
+
+// CommandHistogram Display a bar chart of the number of log messages over time, split by level. The messages are
+// counted by Datadog with a single aggregation over the --start/--end range. Returns false when it failed.
+func CommandHistogram(opts *options.Options) bool {
+	from, err := time.Parse(datadogTimeLayout, opts.StartDate)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid --start '%s' - %s\n", opts.StartDate, err)
+		return false
+	}
+	to, err := time.Parse(datadogTimeLayout, opts.EndDate)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Invalid --end '%s' - %s\n", opts.EndDate, err)
+		return false
+	}
+	bucketSize := histogramBucketSize(to.Sub(from))
+
+	counts, err := histogramCounts(opts, from, bucketSize, int(to.Sub(from)/bucketSize)+1)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't count the log messages - %s\n", err)
+		return false
+	}
+	total := 0
+	for _, c := range counts {
+		total += sum(c)
+	}
+	if total == 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "No log messages found.")
+		return true
+	}
+
+	fmt.Print(renderHistogram(counts, total, from, to, bucketSize, terminalWidth(), opts.UseColor))
+	return true
+}
+
+// The size of the buckets for a range, rounded up to a whole second so the labels stay readable.
+func histogramBucketSize(span time.Duration) time.Duration {
+	size := span / histogramBuckets
+	if size%time.Second != 0 || size == 0 {
+		size = size.Truncate(time.Second) + time.Second
+	}
+	return size
+}
+
+// Count the messages of each level group in each bucket, with a timeseries count grouped by status. Messages below
+// --level are left out.
+func histogramCounts(opts *options.Options, from time.Time, bucketSize time.Duration, buckets int) ([][]int, error) {
+	body := datadogV2.LogsAggregateRequest{
+		Compute: []datadogV2.LogsCompute{{
+			Aggregation: datadogV2.LOGSAGGREGATIONFUNCTION_COUNT,
+			Type:        datadogV2.LOGSCOMPUTETYPE_TIMESERIES.Ptr(),
+			Interval:    datadog.PtrString(fmt.Sprintf("%ds", int(bucketSize/time.Second))),
+		}},
+		Filter: &datadogV2.LogsQueryFilter{
+			Query:   &opts.Query,
+			From:    &opts.StartDate,
+			To:      &opts.EndDate,
+			Indexes: opts.Indexes,
+		},
+		GroupBy: []datadogV2.LogsGroupBy{{Facet: histogramFacet, Limit: datadog.PtrInt64(100)}},
+		Options: &datadogV2.LogsQueryOptions{
+			Timezone: datadog.PtrString("UTC"),
+		},
+	}
+
+	ctx := constructDatadogContext(opts)
+	resp, _, err := datadogV2.NewLogsApi(apiClient(opts)).AggregateLogs(ctx, body)
+	if err != nil {
+		log.Error(*opts, "Error when calling `LogsApi.AggregateLogs`: %v", err)
+		return nil, apiError(err)
+	}
+
+	levels := opts.ServerConfig.Levels()
+	minSeverity, _ := levels.Severity(opts.MinLevel)
+	counts := make([][]int, buckets)
+	for i := range counts {
+		counts[i] = make([]int, len(histogramLevels))
+	}
+	for _, bucket := range resp.GetData().Buckets {
+		status, _ := config.FieldString(bucket.By[histogramFacet])
+		level := levels.Normalize(status)
+		if len(opts.MinLevel) > 0 {
+			if severity, ok := levels.Severity(level); !ok || severity < minSeverity {
+				continue
+			}
+		}
+		group := histogramGroup(levels, level)
+		value, ok := bucket.Computes["c0"]
+		if !ok || value.LogsAggregateBucketValueTimeseries == nil {
+			continue
+		}
+		for _, point := range value.LogsAggregateBucketValueTimeseries.Items {
+			t, err := time.Parse(time.RFC3339, point.GetTime())
+			if err != nil {
+				continue
+			}
+			b := int(t.Sub(from) / bucketSize)
+			if b < 0 {
+				b = 0
+			} else if b >= buckets {
+				b = buckets - 1
+			}
+			counts[b][group] += int(point.GetValue())
+		}
+	}
+	return counts, nil
+}
+
+// Find the histogram level group for a normalized level, using the severity order of the levels.
+func histogramGroup(levels *config.Levels, level string) int {
+	severity, ok := levels.Severity(level)
+	if ok {
+		for i, l := range histogramLevels {
+			if min, found := levels.Severity(l.Min); found && severity >= min {
+				return i
+			}
+		}
+	}
+	return len(histogramLevels) - 1
+}
+
+// Render the histogram as text, one line per time bucket.
+func renderHistogram(counts [][]int, total int, from time.Time, to time.Time, bucketSize time.Duration, width int, useColor bool) string {
+	maxTotal := 0
+	for _, c := range counts {
+		if t := sum(c); t > maxTotal {
+			maxTotal = t
+		}
+	}
+
+	labelFormat := "15:04:05"
+	if to.Sub(from) >= 24*time.Hour {
+		labelFormat = "2006-01-02 15:04"
+	}
+	barWidth := width - len(labelFormat) - histogramCountWidth - 3
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "%d messages from %s to %s, %s per bucket\n\n",
+		total, from.Format(time.RFC3339), to.Format(time.RFC3339), bucketSize)
+	for i, c := range counts {
+		label := from.Add(time.Duration(i) * bucketSize).Format(labelFormat)
+		_, _ = fmt.Fprintf(&sb, "%s %*d ", label, histogramCountWidth, sum(c))
+		sb.WriteString(renderBar(c, maxTotal, barWidth, useColor))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	for i, l := range histogramLevels {
+		if i > 0 {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(histogramSymbol(l, useColor) + " " + l.Name)
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// Render a single bar, scaled so the largest bucket fills the available width.
+func renderBar(counts []int, maxTotal int, width int, useColor bool) string {
+	var sb strings.Builder
+	total := sum(counts)
+	if maxTotal == 0 || total == 0 {
+		return ""
+	}
+	barLength := (total*width + maxTotal - 1) / maxTotal
+	drawn := 0
+	running := 0
+	for i, count := range counts {
+		running += count
+		// Scale the running total so rounding errors don't accumulate across segments
+		end := running * barLength / total
+		if count > 0 && end == drawn {
+			end = drawn + 1
+		}
+		if end > drawn {
+			sb.WriteString(histogramSegment(histogramLevels[i], end-drawn, useColor))
+			drawn = end
+		}
+	}
+	return sb.String()
+}
+
+// The character used to draw a level group.
+func histogramSymbol(l histogramLevel, useColor bool) string {
+	return histogramSegment(l, 1, useColor)
+}
+
+// Draw a segment of a bar for a level group.
+func histogramSegment(l histogramLevel, length int, useColor bool) string {
+	if useColor {
+		return l.Color + strings.Repeat("█", length) + consts.ResetEsc
+	}
+	return strings.Repeat(l.Symbol, length)
+}
+
+// Add up a list of counts.
+func sum(values []int) (total int) {
+	for _, v := range values {
+		total += v
+	}
+	return
+}
+
+// Determine the width of the terminal, falling back to a sensible default when redirected.
+func terminalWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return defaultTerminalWidth
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"doglog/log"
+	"doglog/options"
+	"encoding/json"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV1"
+	"github.com/akamensky/argparse"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The flags of the indexes subcommand.
+type indexesFlags struct {
+	json *bool
+}
+
+// Add the flags of the indexes subcommand.
+func addIndexesFlags(cmd *argparse.Command) *indexesFlags {
+	return &indexesFlags{
+		json: cmd.Flag("j", "json", &argparse.Options{Required: false, Help: "Output one json object per index."}),
+	}
+}
+
+// Copy the indexes flags into the options.
+func (f *indexesFlags) apply(opts *options.Options) {
+	opts.OutputJson = *f.json
+}
+
+// A log index, as listed by the indexes subcommand.
+type logIndex struct {
+	Name          string `json:"name"`
+	Filter        string `json:"filter"`
+	RetentionDays int64  `json:"retention_days,omitempty"`
+	DailyLimit    int64  `json:"daily_limit,omitempty"`
+}
+
+// Fetch the log indexes of the organization.
+func listIndexes(opts *options.Options) ([]logIndex, error) {
+	ctx := constructDatadogContext(opts)
+	resp, _, err := datadogV1.NewLogsIndexesApi(apiClient(opts)).ListLogIndexes(ctx)
+	if err != nil {
+		log.Error(*opts, "Error when calling `LogsIndexesApi.ListLogIndexes`: %v", err)
+		return nil, apiError(err)
+	}
+	var indexes []logIndex
+	for _, index := range resp.GetIndexes() {
+		indexes = append(indexes, logIndex{
+			Name:          index.GetName(),
+			Filter:        index.Filter.GetQuery(),
+			RetentionDays: index.GetNumRetentionDays(),
+			DailyLimit:    index.GetDailyLimit(),
+		})
+	}
+	return indexes, nil
+}
+
+// CommandIndexes List the log indexes with their filter, retention and daily limit. Returns the exit code.
+func CommandIndexes(opts *options.Options) int {
+	indexes, err := cachedIndexes(opts, true)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't list the log indexes - %s\n", err)
+		return 1
+	}
+
+	if opts.OutputJson {
+		for _, index := range indexes {
+			buf, _ := json.Marshal(index)
+			fmt.Println(string(buf))
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tFILTER\tRETENTION\tDAILY LIMIT")
+	for _, index := range indexes {
+		retention, limit := "-", "none"
+		if index.RetentionDays > 0 {
+			retention = fmt.Sprintf("%d days", index.RetentionDays)
+		}
+		if index.DailyLimit > 0 {
+			limit = strconv.FormatInt(index.DailyLimit, 10)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", index.Name, index.Filter, retention, limit)
+	}
+	_ = w.Flush()
+	return 0
+}
+
+// The log indexes by name, and their names. Both are empty when the indexes can't be listed.
+func indexesByName(opts *options.Options, refresh bool) (map[string]logIndex, []string) {
+	indexes, err := cachedIndexes(opts, refresh)
+	if err != nil {
+		return nil, nil
+	}
+	known := make(map[string]logIndex, len(indexes))
+	var names []string
+	for _, index := range indexes {
+		known[index.Name] = index
+		names = append(names, index.Name)
+	}
+	return known, names
+}
+
+// CheckIndexes Check the -i/--indices of a search against the indexes of the organization, and warn on stderr when
+// --start is older than the retention of an index. The default index isn't checked, so only the searches that pick
+// their indexes list them. The check is skipped when the indexes can't be listed, e.g. when the application key isn't
+// allowed to read them.
+func CheckIndexes(opts *options.Options) error {
+	if len(opts.Indexes) == 0 || slices.Equal(opts.Indexes, defaultIndices) {
+		return nil
+	}
+	known, names := indexesByName(opts, false)
+	for _, name := range opts.Indexes {
+		if _, ok := known[name]; !ok && name != "*" && len(known) > 0 {
+			// The index may be newer than the cache
+			if !recentRefresh(opts, "indexes") {
+				if refreshed, refreshedNames := indexesByName(opts, true); len(refreshed) > 0 {
+					known, names = refreshed, refreshedNames
+				}
+			}
+			if _, ok := known[name]; !ok {
+				return fmt.Errorf("unknown index '%s', use one of %s (see 'doglog indexes')", name, strings.Join(names, ", "))
+			}
+		}
+	}
+
+	if opts.Command == GetCommand {
+		// The range only bounds the search for the message
+		return nil
+	}
+	now := time.Now()
+	start, err := resolveTime(opts.StartDate, now)
+	if err != nil {
+		return nil
+	}
+	for _, name := range opts.Indexes {
+		days := known[name].RetentionDays
+		if days > 0 && start.Before(now.Add(-time.Duration(days)*24*time.Hour)) {
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: --start %s is older than the %d days the index %s keeps, the older messages are gone\n",
+				opts.StartDate, days, name)
+		}
+	}
+	return nil
+}
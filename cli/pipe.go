@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bufio"
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// messagePipe is a long-lived command that receives every message as a line of JSON on its stdin.
+type messagePipe struct {
+	mu      sync.Mutex
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	output  chan struct{}
+	broken  bool
+}
+
+// The command started for --pipe.
+var pipe *messagePipe
+
+// Start the --pipe command. When the command's output is used as the rendered output its stdout lines are printed
+// to our stdout, otherwise they go to stderr so they don't mix with the formatted messages.
+func startPipe(opts *options.Options) (*messagePipe, error) {
+	p := &messagePipe{command: opts.Pipe, cmd: shellCommand(opts.Pipe)}
+	p.cmd.Stderr = os.Stderr
+
+	stdin, err := p.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.stdin = stdin
+
+	var stdout io.ReadCloser
+	if opts.PipeOutput {
+		if stdout, err = p.cmd.StdoutPipe(); err != nil {
+			return nil, err
+		}
+	} else {
+		p.cmd.Stdout = os.Stderr
+	}
+
+	if err := p.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	if stdout != nil {
+		p.output = make(chan struct{})
+		go func() {
+			defer close(p.output)
+			scanner := bufio.NewScanner(stdout)
+			scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+			for scanner.Scan() {
+				fmt.Println(scanner.Text())
+			}
+		}()
+	}
+	return p, nil
+}
+
+// Wrap a message handler so every message is also written to the --pipe command. When the command's output is the
+// rendered output, the messages are only normalized and not printed.
+func pipeMessages(opts *options.Options, handle messageHandler) messageHandler {
+	if pipe == nil {
+		p, err := startPipe(opts)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Can't start --pipe command '%s' - %s\n", opts.Pipe, err)
+			os.Exit(1)
+		}
+		pipe = p
+	}
+	if opts.PipeOutput {
+		handle = func(opts *options.Options, msg *datadogV2.Log) {
+			adjustMap(opts, msg)
+		}
+	}
+	return func(opts *options.Options, msg *datadogV2.Log) {
+		handle(opts, msg)
+		pipe.write(messageJson(*msg))
+	}
+}
+
+// Write a single line to the command's stdin. Once the command stops reading, further lines are dropped.
+func (p *messagePipe) write(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.broken {
+		return
+	}
+	if _, err := p.stdin.Write(append(line, '\n')); err != nil {
+		p.broken = true
+		_, _ = fmt.Fprintf(os.Stderr, "The --pipe command '%s' stopped reading messages - %s\n", p.command, err)
+	}
+}
+
+// ClosePipe Close the --pipe command's stdin and wait for it to finish writing its output.
+func ClosePipe() {
+	if pipe == nil {
+		return
+	}
+	pipe.mu.Lock()
+	_ = pipe.stdin.Close()
+	pipe.broken = true
+	pipe.mu.Unlock()
+
+	if pipe.output != nil {
+		<-pipe.output
+	}
+	if err := pipe.cmd.Wait(); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "The --pipe command '%s' failed - %s\n", pipe.command, err)
+	}
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"doglog/options"
+	"fmt"
+	"github.com/akamensky/argparse"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The characters that must be escaped in a value of the Datadog search syntax.
+const specialCharacters = `+-=&|><!(){}[]^"“”~*?:\/ ` + "\t"
+
+// The name of an attribute, tag or facet.
+var attributeName = regexp.MustCompile(`^@?[A-Za-z0-9_][A-Za-z0-9_.\-]*$`)
+
+// A numeric comparison of an attribute, e.g. '@duration>500ms', 'status_code>=500' or 'size=10..20'.
+var attributeRange = regexp.MustCompile(`^(@?[A-Za-z0-9_][A-Za-z0-9_.\-]*)\s*(>=|<=|>|<|=)\s*(.+)$`)
+
+// The flags that add filters to the query, so values don't have to be escaped by hand.
+type queryFlags struct {
+	hosts      *[]string
+	envs       *[]string
+	statuses   *[]string
+	tags       *[]string
+	attrs      *[]string
+	attrsNot   *[]string
+	attrRanges *[]string
+}
+
+// Add the query filter flags to a subcommand.
+func addQueryFlags(cmd *argparse.Command) *queryFlags {
+	return &queryFlags{
+		hosts:      cmd.StringList("", "host", &argparse.Options{Required: false, Help: "Only the messages of this host. Repeat the parameter to search several hosts"}),
+		envs:       cmd.StringList("", "env", &argparse.Options{Required: false, Help: "Only the messages with this env tag, e.g., '--env staging'. Repeat the parameter to search several envs"}),
+		statuses:   cmd.StringList("", "status", &argparse.Options{Required: false, Help: "Only the messages with this Datadog status, e.g., '--status error'. Repeat the parameter to search several statuses"}),
+		tags:       cmd.StringList("", "tag", &argparse.Options{Required: false, Help: "Only the messages with this tag, e.g., '--tag team:payments'. Repeat the parameter to require several tags"}),
+		attrs:      cmd.StringList("", "attr", &argparse.Options{Required: false, Help: "Only the messages whose attribute has this value, e.g., '--attr http.url=https://example.com/a b'. The value is escaped, so spaces, colons, quotes and wildcards are matched literally. Repeat the parameter to require several attributes"}),
+		attrsNot:   cmd.StringList("", "attr-not", &argparse.Options{Required: false, Help: "Leave out the messages whose attribute has this value, e.g., '--attr-not http.status_code=404'. Repeat the parameter to leave out several values"}),
+		attrRanges: cmd.StringList("", "attr-range", &argparse.Options{Required: false, Help: "Only the messages whose numeric attribute compares to a value with >, >=, < or <=, or is in a range with '=', e.g., '@duration>500ms' or 'http.status_code=500..599'. Durations (ns, us, ms, s, m, h) are converted to nanoseconds. Repeat the parameter to add comparisons"}),
+	}
+}
+
+// Copy the query filter flags into the options.
+func (f *queryFlags) apply(opts *options.Options) {
+	opts.Hosts = *f.hosts
+	opts.Envs = *f.envs
+	opts.Statuses = *f.statuses
+	opts.Tags = *f.tags
+	opts.Attrs = *f.attrs
+	opts.AttrsNot = *f.attrsNot
+	opts.AttrRanges = *f.attrRanges
+}
+
+// Escape a value for the Datadog search syntax, so it's matched literally.
+func escapeValue(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(specialCharacters, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Add the '@' that marks an attribute, unless it's there already.
+func attributeKey(key string) string {
+	if strings.HasPrefix(key, "@") {
+		return key
+	}
+	return "@" + key
+}
+
+// Build the search terms of a repeated flag: a single term, or the terms joined with OR.
+func anyOf(key string, values []string) string {
+	var terms []string
+	for _, value := range values {
+		terms = append(terms, key+":"+escapeValue(value))
+	}
+	if len(terms) > 1 {
+		return "(" + strings.Join(terms, " OR ") + ")"
+	}
+	return strings.Join(terms, "")
+}
+
+// Split a 'key=value' argument.
+func splitAttribute(flag string, arg string) (string, string, error) {
+	key, value, ok := strings.Cut(arg, "=")
+	key = strings.TrimSpace(key)
+	if !ok || !attributeName.MatchString(key) {
+		return "", "", fmt.Errorf("the %s argument '%s' must be an attribute name, '=' and a value, e.g., 'http.method=POST'", flag, arg)
+	}
+	return attributeKey(key), value, nil
+}
+
+// Convert a bound of a range to a number. Durations are converted to nanoseconds, the unit of Datadog's @duration.
+func rangeBound(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "*" {
+		return value, nil
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return strconv.FormatInt(d.Nanoseconds(), 10), nil
+	}
+	return "", fmt.Errorf("'%s' isn't a number or a duration", value)
+}
+
+// Build the search term of an --attr-range argument.
+func rangeTerm(arg string) (string, error) {
+	m := attributeRange.FindStringSubmatch(strings.TrimSpace(arg))
+	if m == nil {
+		return "", fmt.Errorf("the --attr-range argument '%s' must be an attribute, a comparison and a value, e.g., '@duration>500ms'", arg)
+	}
+	key := attributeKey(m[1])
+	if m[2] == "=" {
+		low, high, ok := strings.Cut(m[3], "..")
+		if !ok {
+			return "", fmt.Errorf("the --attr-range argument '%s' must use a range with '=', e.g., 'http.status_code=500..599'", arg)
+		}
+		from, err := rangeBound(low)
+		if err != nil {
+			return "", fmt.Errorf("invalid --attr-range '%s' - %s", arg, err)
+		}
+		to, err := rangeBound(high)
+		if err != nil {
+			return "", fmt.Errorf("invalid --attr-range '%s' - %s", arg, err)
+		}
+		return fmt.Sprintf("%s:[%s TO %s]", key, from, to), nil
+	}
+	bound, err := rangeBound(m[3])
+	if err != nil {
+		return "", fmt.Errorf("invalid --attr-range '%s' - %s", arg, err)
+	}
+	return key + ":" + m[2] + bound, nil
+}
+
+// Build the search terms of the query filter flags, escaping the values.
+func queryFilters(opts options.Options) (string, error) {
+	var terms []string
+	for _, group := range []struct {
+		key    string
+		values []string
+	}{{"host", opts.Hosts}, {"env", opts.Envs}, {"status", opts.Statuses}} {
+		if term := anyOf(group.key, group.values); len(term) > 0 {
+			terms = append(terms, term)
+		}
+	}
+	for _, tag := range opts.Tags {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || !attributeName.MatchString(key) || strings.HasPrefix(key, "@") {
+			return "", fmt.Errorf("the --tag argument '%s' must be a tag name, ':' and a value, e.g., 'team:payments'", tag)
+		}
+		terms = append(terms, key+":"+escapeValue(value))
+	}
+	for _, attr := range opts.Attrs {
+		key, value, err := splitAttribute("--attr", attr)
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, key+":"+escapeValue(value))
+	}
+	for _, attr := range opts.AttrsNot {
+		key, value, err := splitAttribute("--attr-not", attr)
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, "-"+key+":"+escapeValue(value))
+	}
+	for _, arg := range opts.AttrRanges {
+		term, err := rangeTerm(arg)
+		if err != nil {
+			return "", err
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// Add the terms of the query filter flags to the -q query. The default '*' query is left out when there are terms.
+func addFilters(filters string, query string) string {
+	query = strings.TrimSpace(query)
+	switch {
+	case len(filters) == 0:
+		return query
+	case len(query) == 0 || query == "*":
+		return filters
+	}
+	return filters + " " + groupQuery(query)
+}
+
+// Group a query in parentheses when it has a top-level OR, so the terms added before it apply to all of it:
+// 'host:h a OR b' would be '(host:h a) OR b'.
+func groupQuery(query string) string {
+	depth := 0
+	quoted := false
+	word := strings.Builder{}
+	for i := 0; i <= len(query); i++ {
+		var c byte = ' '
+		if i < len(query) {
+			c = query[i]
+		}
+		switch {
+		case c == '\\' && i+1 < len(query):
+			word.WriteByte(c)
+			word.WriteByte(query[i+1])
+			i++
+			continue
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ' ' || c == '\t' || c == '\n':
+			if depth == 0 && word.String() == "OR" {
+				return "(" + query + ")"
+			}
+			word.Reset()
+			continue
+		}
+		word.WriteByte(c)
+	}
+	return query
+}
@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"doglog/config"
+	"doglog/options"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// How often the configuration files are checked for changes while tailing.
+const configPollInterval = 2 * time.Second
+
+// ConfigWatcher Reloads the configuration while tailing when one of the configuration files changes, or when asked
+// to (SIGHUP). The new configuration is loaded in the background and swapped in between two polls of Datadog.
+type ConfigWatcher struct {
+	configPath string
+	// The configuration the tail started with, whose [server] section and keys are kept
+	initial *config.IniFile
+	// The modification times of the files of the current configuration
+	modified map[string]time.Time
+	requests chan struct{}
+	reloaded chan configReload
+}
+
+// The result of reloading the configuration: the new configuration, or nil when it couldn't be loaded, and the
+// message to show.
+type configReload struct {
+	conf    *config.IniFile
+	message string
+}
+
+// NewConfigWatcher Start watching the files of the current configuration.
+func NewConfigWatcher(opts *options.Options) *ConfigWatcher {
+	// Get the keys now, the reloaded configurations reuse them instead of running the key commands or asking for the
+	// passphrase in the background
+	_, _ = opts.ServerConfig.ApiKey(), opts.ServerConfig.ApplicationKey()
+	w := &ConfigWatcher{
+		configPath: opts.ConfigPath,
+		initial:    opts.ServerConfig,
+		modified:   modificationTimes(watchedPaths(opts.ConfigPath, opts.ServerConfig.Paths())),
+		requests:   make(chan struct{}, 1),
+		reloaded:   make(chan configReload, 1),
+	}
+	go w.watch(opts.ServerConfig.Paths())
+	return w
+}
+
+// Reload Ask for the configuration to be reloaded even if no file changed.
+func (w *ConfigWatcher) Reload() {
+	select {
+	case w.requests <- struct{}{}:
+	default:
+	}
+}
+
+// Apply Swap in the configuration that was reloaded since the last call, if any, and report the problems found in
+// it. Returns true when the configuration changed.
+func (w *ConfigWatcher) Apply(opts *options.Options, s *StatusLine) bool {
+	var reload configReload
+	select {
+	case reload = <-w.reloaded:
+	default:
+		return false
+	}
+
+	message := reload.message
+	if reload.conf != nil {
+		opts.ServerConfig = reload.conf
+		if len(opts.MinLevel) > 0 {
+			if _, ok := reload.conf.Levels().Severity(opts.MinLevel); !ok {
+				message += fmt.Sprintf("\nThe --level %s is not one of the reloaded levels, showing all messages", opts.MinLevel)
+				opts.MinLevel = ""
+			}
+		}
+	}
+
+	// Don't garble the status line
+	if s != nil {
+		s.Stop()
+		defer s.Start()
+	}
+	_, _ = fmt.Fprintln(os.Stderr, message)
+	return reload.conf != nil
+}
+
+// Poll the configuration files and reload the configuration when one of them changes or a reload is requested.
+func (w *ConfigWatcher) watch(paths []string) {
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		forced := false
+		select {
+		case <-ticker.C:
+		case <-w.requests:
+			forced = true
+		}
+
+		current := modificationTimes(watchedPaths(w.configPath, paths))
+		if !forced && sameModificationTimes(w.modified, current) {
+			continue
+		}
+		w.modified = current
+
+		conf, err := w.load()
+		if err != nil {
+			w.send(configReload{message: fmt.Sprintf("Can't reload the configuration, still using the previous one - %s", err)})
+			continue
+		}
+		paths = conf.Paths()
+		w.modified = modificationTimes(watchedPaths(w.configPath, paths))
+
+		var messages []string
+		for _, p := range conf.Check() {
+			if p.Level == config.ProblemError {
+				messages = append(messages, p.String())
+			}
+		}
+		messages = append([]string{"Reloaded the configuration from " + strings.Join(paths, ", ")}, messages...)
+		w.send(configReload{conf: conf, message: strings.Join(messages, "\n")})
+	}
+}
+
+// Hand a reload to the tail, replacing the one that hasn't been applied yet. A failed reload doesn't replace a
+// successful one.
+func (w *ConfigWatcher) send(reload configReload) {
+	select {
+	case pending := <-w.reloaded:
+		if reload.conf == nil && pending.conf != nil {
+			pending.message += "\n" + reload.message
+			reload = pending
+		}
+	default:
+	}
+	w.reloaded <- reload
+}
+
+// Read the configuration files again. The [server] section isn't reloaded: the tail keeps the site and the keys it
+// started with.
+func (w *ConfigWatcher) load() (*config.IniFile, error) {
+	paths, err := configPaths(w.configPath)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := config.New(paths...)
+	if err != nil {
+		return nil, err
+	}
+	conf.KeepServer(w.initial)
+	// The warning was already shown when the tail started
+	if err := conf.CheckPermissions(io.Discard); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// The files to watch: the files of the configuration, plus the files in the search path so a new project file is
+// picked up.
+func watchedPaths(configPath string, paths []string) []string {
+	if len(configPath) > 0 {
+		return paths
+	}
+	watched := append([]string{}, paths...)
+	for _, path := range config.SearchPaths() {
+		if !containsString(watched, path) {
+			watched = append(watched, path)
+		}
+	}
+	return watched
+}
+
+// Get the modification times of files. Missing files are left out.
+func modificationTimes(paths []string) map[string]time.Time {
+	times := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// Check whether two sets of modification times are the same.
+func sameModificationTimes(a map[string]time.Time, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, t := range a {
+		if other, ok := b[path]; !ok || !other.Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether a list of strings contains a string.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"bufio"
+	"doglog/config"
+	"doglog/options"
+	"fmt"
+	"github.com/akamensky/argparse"
+	"golang.org/x/term"
+	"os"
+	"strings"
+)
+
+// The 'secrets' subcommands.
+type secretsCommands struct {
+	cmd     *argparse.Command
+	set     *argparse.Command
+	name    *string
+	file    *string
+	keyFile *string
+}
+
+// Add the 'secrets' subcommands to the parser.
+func addSecretsCommands(parser *argparse.Parser) *secretsCommands {
+	c := &secretsCommands{}
+	c.cmd = parser.NewCommand(SecretsCommand, "Manage the encrypted file holding the Datadog keys.")
+	c.set = c.cmd.NewCommand("set", "Store a key in the encrypted secrets file, creating the file if needed. The key is read from the terminal, or from stdin when it isn't a terminal.")
+	c.name = c.set.SelectorPositional(config.SecretNames(), &argparse.Options{Help: "The key to store: " + strings.Join(config.SecretNames(), " or ")})
+	c.file = c.set.String("f", "file", &argparse.Options{Required: false, Help: "Path to the secrets file. Defaults to the secrets-file of the [server] section, or ~/.doglog.secrets"})
+	c.keyFile = c.set.String("", "key-file", &argparse.Options{Required: false, Help: "A file whose contents unlock the secrets file instead of a passphrase. Defaults to the secrets-key-file of the [server] section or $DOGLOG_SECRETS_KEY_FILE"})
+	return c
+}
+
+// Check whether a 'secrets' subcommand was given.
+func (c *secretsCommands) happened() bool {
+	return c.cmd.Happened()
+}
+
+// Run the 'secrets' subcommand that was given and return the exit code.
+func (c *secretsCommands) run(opts *options.Options) int {
+	if c.set.Happened() {
+		return CommandSecretsSet(opts.ConfigPath, *c.file, *c.keyFile, *c.name)
+	}
+	return 0
+}
+
+// CommandSecretsSet Store a key in the encrypted secrets file. Returns the exit code.
+func CommandSecretsSet(configPath string, file string, keyFile string, name string) int {
+	// The configuration is optional, it only tells where the secrets file and the key file are
+	var conf *config.IniFile
+	if paths, err := configPaths(configPath); err == nil {
+		conf, _ = config.New(paths...)
+	}
+	if len(file) == 0 && conf != nil {
+		file = conf.SecretsFile()
+	}
+	if len(file) == 0 {
+		file = config.DefaultSecretsFile()
+	}
+	if len(keyFile) == 0 && conf != nil {
+		keyFile = conf.SecretsKeyFile()
+	}
+	if err := config.CheckKeyFile(keyFile, conf != nil && conf.StrictPermissions(), os.Stderr); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't unlock the secrets file %s - %s\n", file, err)
+		return 1
+	}
+
+	_, err := os.Stat(file)
+	exists := err == nil
+	passphrase, err := config.SecretsPassphrase(file, keyFile, !exists)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't unlock the secrets file %s - %s\n", file, err)
+		return 1
+	}
+	secrets := make(map[string]string)
+	if exists {
+		if secrets, err = config.ReadSecrets(file, passphrase); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Can't read the secrets file %s - %s\n", file, err)
+			return 1
+		}
+	}
+
+	value, err := readSecretValue(name)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't read the %s - %s\n", name, err)
+		return 1
+	}
+	if len(value) == 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "The %s is empty, nothing stored\n", name)
+		return 1
+	}
+	secrets[name] = value
+
+	if err := config.WriteSecrets(file, passphrase, secrets); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't write the secrets file %s - %s\n", file, err)
+		return 1
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Stored the %s in %s\n", name, file)
+	if conf != nil && file != conf.SecretsFile() {
+		_, _ = fmt.Fprintf(os.Stderr, "Add 'secrets-file = %s' to the [server] section so doglog uses it\n", file)
+	}
+	if conf != nil && len(conf.InsecurePaths()) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Remove the plaintext keys from %s, they are used before the secrets file\n", strings.Join(conf.InsecurePaths(), ", "))
+	}
+	return 0
+}
+
+// Read the value of a key without echoing it, or from stdin when it isn't a terminal.
+func readSecretValue(name string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: ", name)
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		_, _ = fmt.Fprintln(os.Stderr)
+		return strings.TrimSpace(string(value)), err
+	}
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(value) == 0 {
+		return "", err
+	}
+	return strings.TrimSpace(value), nil
+}
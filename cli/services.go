@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"doglog/options"
+	"fmt"
+	"github.com/akamensky/argparse"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The window in which services are discovered when no --start is provided by the user.
+const defaultServicesRange = "now-1d"
+
+// The flags of the services subcommand.
+type servicesFlags struct {
+	pattern *string
+	start   *string
+	refresh *bool
+}
+
+// Add the flags of the services subcommand.
+func addServicesFlags(cmd *argparse.Command) *servicesFlags {
+	return &servicesFlags{
+		pattern: cmd.StringPositional(&argparse.Options{Help: "Only list the services matching this name, the way -s ~name is matched, e.g., 'recon'"}),
+		start:   cmd.String("", "start", &argparse.Options{Required: false, Help: "Discover the services that logged since this date/time. Only the services of the last day are cached", Default: defaultServicesRange}),
+		refresh: cmd.Flag("", "refresh", &argparse.Options{Required: false, Help: "Discover the services again instead of using the cache."}),
+	}
+}
+
+// Copy the services flags into the options.
+func (f *servicesFlags) apply(opts *options.Options) {
+	opts.Service = *f.pattern
+	opts.StartDate = *f.start
+	opts.Refresh = *f.refresh
+}
+
+// Find the services that logged since start, sorted by name.
+func discoverServices(opts *options.Options, start string) ([]string, error) {
+	search := *opts
+	search.Query = "*"
+	search.StartDate = start
+	search.EndDate = "now"
+	search.Indexes = []string{"*"}
+	groups, err := aggregate(&search, []string{"service"}, []string{"count"}, 10000)
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for _, g := range groups {
+		if service := g.By["service"]; len(service) > 0 {
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// The services that logged during the last day, from the cache when it's fresh. After a failure, the services aren't
+// discovered again for failureTTL unless refresh is set.
+func cachedServices(opts *options.Options, refresh bool) ([]string, error) {
+	var services []string
+	if !refresh && readCache(opts, "services", cacheTTL, &services) {
+		return services, nil
+	}
+	if !refresh && recentFailure(opts, "services") {
+		return nil, errRecentFailure
+	}
+	services, err := discoverServices(opts, defaultServicesRange)
+	if err != nil {
+		recordFailure(opts, "services")
+		return nil, err
+	}
+	writeCache(opts, "services", services)
+	return services, nil
+}
+
+// Find the services matching a name: the service with that exact name, else the services containing it, else the
+// services containing its letters in order, e.g. 'prw' matches 'payments-reconciliation-worker'. Case is ignored.
+func matchServices(services []string, name string) []string {
+	name = strings.ToLower(name)
+	for _, service := range services {
+		if strings.ToLower(service) == name {
+			return []string{service}
+		}
+	}
+	var matches []string
+	for _, service := range services {
+		if strings.Contains(strings.ToLower(service), name) {
+			matches = append(matches, service)
+		}
+	}
+	if len(matches) > 0 {
+		return matches
+	}
+	for _, service := range services {
+		if isSubsequence(name, strings.ToLower(service)) {
+			matches = append(matches, service)
+		}
+	}
+	return matches
+}
+
+// Check whether the letters of short appear in long, in the same order.
+func isSubsequence(short string, long string) bool {
+	i := 0
+	for j := 0; i < len(short) && j < len(long); j++ {
+		if short[i] == long[j] {
+			i++
+		}
+	}
+	return i == len(short)
+}
+
+// Resolve the -s/--service argument against the services seen during the last day. A name starting with '~' is
+// matched: a unique match replaces the argument, several matches are an error listing them. Other names are used as
+// given, with a warning listing the services containing them when they didn't log during the last day. Wildcards, or
+// services that can't be discovered, are used as given.
+func resolveService(opts *options.Options) (string, error) {
+	service := opts.Service
+	fuzzy := strings.HasPrefix(service, "~")
+	if fuzzy {
+		service = service[1:]
+		if len(service) == 0 {
+			return "", fmt.Errorf("'-s ~' needs a part of the service name, e.g. '-s ~recon'")
+		}
+	}
+	if len(service) == 0 || strings.ContainsAny(service, "*?") {
+		return service, nil
+	}
+	services, err := cachedServices(opts, false)
+	if err != nil || len(services) == 0 {
+		return service, nil
+	}
+	if !containsService(services, service) && !recentRefresh(opts, "services") {
+		// The service may be newer than the cache
+		if refreshed, err := cachedServices(opts, true); err == nil {
+			services = refreshed
+		}
+	}
+	if containsService(services, service) {
+		return service, nil
+	}
+
+	matches := matchServices(services, service)
+	switch {
+	case len(matches) == 0:
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: no service '%s' logged during the last day, see 'doglog services'\n", service)
+		return service, nil
+	case !fuzzy:
+		// The service may have logged before the last day, which is all the cache covers
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: no service '%s' logged during the last day, did you mean %s? Use '-s ~%s' to match a part of the name\n",
+			service, strings.Join(matches, ", "), service)
+		return service, nil
+	case len(matches) > 1:
+		return "", fmt.Errorf("the service '%s' matches several services, use one of %s", service, strings.Join(matches, ", "))
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Using the service %s\n", matches[0])
+	return matches[0], nil
+}
+
+// Check whether a service has exactly the given name.
+func containsService(services []string, name string) bool {
+	for _, service := range services {
+		if service == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CommandServices List the services that logged recently, optionally only the ones matching a name. Returns the exit
+// code.
+func CommandServices(opts *options.Options) int {
+	var services []string
+	var err error
+	if opts.StartDate == defaultServicesRange {
+		services, err = cachedServices(opts, opts.Refresh)
+	} else {
+		services, err = discoverServices(opts, opts.StartDate)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't discover the services - %s\n", err)
+		return 1
+	}
+	if len(opts.Service) > 0 {
+		services = matchServices(services, opts.Service)
+	}
+	for _, service := range services {
+		fmt.Println(service)
+	}
+	return 0
+}
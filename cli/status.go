@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the status line is redrawn.
+const statusRefresh = 500 * time.Millisecond
+
+// The window used to compute the message rates.
+const statusWindow = 5 * time.Minute
+
+// A message seen while tailing, used to compute the rolling message rates.
+type statusEvent struct {
+	received time.Time
+	level    string
+}
+
+// StatusLine A single line on stderr showing the health of the tail: message rates by level, time since the
+// last message, the current poll delay and the last API error.
+type StatusLine struct {
+	mu          sync.Mutex
+	out         *os.File
+	enabled     bool
+	running     bool
+	done        chan struct{}
+	started     time.Time
+	events      []statusEvent
+	lastMessage time.Time
+	delay       float64
+	nextPoll    time.Time
+	lastError   error
+	lastErrorAt time.Time
+}
+
+// NewStatusLine Create a status line. Nothing is drawn when stderr isn't a terminal.
+func NewStatusLine() *StatusLine {
+	return &StatusLine{
+		out:     os.Stderr,
+		enabled: term.IsTerminal(int(os.Stderr.Fd())),
+		started: time.Now(),
+	}
+}
+
+// Start drawing the status line.
+func (s *StatusLine) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.enabled || s.running {
+		return
+	}
+	s.running = true
+	s.done = make(chan struct{})
+	go s.refresh(s.done)
+}
+
+// Stop drawing the status line and clear it so other output can be written.
+func (s *StatusLine) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+	s.running = false
+	close(s.done)
+	_, _ = fmt.Fprint(s.out, "\r\033[K")
+}
+
+// Record a message that was displayed.
+func (s *StatusLine) Record(level string, timestamp *time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.events = append(s.events, statusEvent{received: now, level: level})
+	if timestamp != nil && timestamp.After(s.lastMessage) {
+		s.lastMessage = *timestamp
+	} else if timestamp == nil {
+		s.lastMessage = now
+	}
+}
+
+// SetDelay Record the delay before the next poll of Datadog.
+func (s *StatusLine) SetDelay(delay float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delay = delay
+	s.nextPoll = time.Now().Add(time.Duration(delay * float64(time.Second)))
+}
+
+// SetError Record the result of the last call to Datadog. A nil error leaves the previous error visible.
+func (s *StatusLine) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastError = err
+	s.lastErrorAt = time.Now()
+}
+
+// Redraw the status line until stopped.
+func (s *StatusLine) refresh(done chan struct{}) {
+	ticker := time.NewTicker(statusRefresh)
+	defer ticker.Stop()
+	for {
+		s.draw()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Draw the status line once.
+func (s *StatusLine) draw() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return
+	}
+	text := s.text(time.Now())
+	if width, _, err := term.GetSize(int(s.out.Fd())); err == nil && width > 1 && len([]rune(text)) >= width {
+		text = string([]rune(text)[:width-1])
+	}
+	_, _ = fmt.Fprint(s.out, "\r"+text+"\033[K")
+}
+
+// Build the text of the status line.
+func (s *StatusLine) text(now time.Time) string {
+	// Drop the events that have fallen out of the window
+	cutoff := now.Add(-statusWindow)
+	i := 0
+	for i < len(s.events) && s.events[i].received.Before(cutoff) {
+		i++
+	}
+	s.events = s.events[i:]
+
+	minutes := now.Sub(s.started).Minutes()
+	if minutes > statusWindow.Minutes() {
+		minutes = statusWindow.Minutes()
+	}
+	if minutes < 1 {
+		minutes = 1
+	}
+
+	counts := make(map[string]int)
+	for _, e := range s.events {
+		counts[e.level]++
+	}
+	rates := make([]string, 0, len(counts))
+	for _, c := range topCounts(counts, 0) {
+		rates = append(rates, fmt.Sprintf("%s %.1f", c.name, float64(c.count)/minutes))
+	}
+
+	parts := []string{fmt.Sprintf("%.1f msg/min", float64(len(s.events))/minutes)}
+	if len(rates) > 0 {
+		parts[0] += " (" + strings.Join(rates, ", ") + ")"
+	}
+	if s.lastMessage.IsZero() {
+		parts = append(parts, "no messages yet")
+	} else {
+		parts = append(parts, "last message "+formatAge(now.Sub(s.lastMessage))+" ago")
+	}
+	if s.delay > 0 {
+		next := s.nextPoll.Sub(now)
+		if next < 0 {
+			next = 0
+		}
+		parts = append(parts, fmt.Sprintf("polling every %.0fs (next in %s)", s.delay, formatAge(next)))
+	}
+	if s.lastError != nil {
+		message := strings.Join(strings.Fields(s.lastError.Error()), " ")
+		parts = append(parts, fmt.Sprintf("last error %s ago: %s", formatAge(now.Sub(s.lastErrorAt)), message))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// Format a duration as a short, whole-second age.
+func formatAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"doglog/consts"
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of entries shown for each of the "top" lists in the summary.
+const summaryTopCount = 10
+
+// Statistics gathered about the messages displayed during this run.
+type runSummary struct {
+	mu         sync.Mutex
+	messages   int
+	pages      int
+	truncated  bool
+	first      time.Time
+	last       time.Time
+	levels     map[string]int
+	services   map[string]int
+	hosts      map[string]int
+	classnames map[string]int
+}
+
+// The statistics for this run. Only created when --summary is requested.
+var summary *runSummary
+
+// A single entry of a "top" list.
+type summaryCount struct {
+	name  string
+	count int
+}
+
+// Create an empty set of statistics.
+func newRunSummary() *runSummary {
+	return &runSummary{
+		levels:     make(map[string]int),
+		services:   make(map[string]int),
+		hosts:      make(map[string]int),
+		classnames: make(map[string]int),
+	}
+}
+
+// Wrap a message handler so every message is added to the run statistics.
+func summarize(handle messageHandler) messageHandler {
+	if summary == nil {
+		summary = newRunSummary()
+	}
+	return func(opts *options.Options, msg *datadogV2.Log) {
+		handle(opts, msg)
+		summary.record(msg)
+	}
+}
+
+// Add a (normalized) log message to the statistics.
+func (s *runSummary) record(msg *datadogV2.Log) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := msg.GetAttributes()
+	s.messages++
+	if ts := attributes.Timestamp; ts != nil {
+		if s.first.IsZero() || ts.Before(s.first) {
+			s.first = *ts
+		}
+		if ts.After(s.last) {
+			s.last = *ts
+		}
+	}
+	increment(s.levels, getField(msg.AdditionalProperties, consts.ComputedLevelField))
+	increment(s.services, attributes.GetService())
+	increment(s.hosts, attributes.GetHost())
+	increment(s.classnames, getField(msg.AdditionalProperties, consts.ComputedClassNameField))
+}
+
+// Record a page fetched from Datadog. Empty pages, e.g. a tail poll that found nothing new, aren't counted. The results
+// are truncated when fetching stopped while Datadog still had a next page.
+func (s *runSummary) recordPage(messages int, truncated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if messages > 0 {
+		s.pages++
+	}
+	s.truncated = s.truncated || truncated
+}
+
+// PrintSummary Print the statistics for this run to stderr. Does nothing unless --summary was requested.
+func PrintSummary(opts *options.Options) {
+	if !opts.Summary || summary == nil {
+		return
+	}
+	summary.mu.Lock()
+	defer summary.mu.Unlock()
+
+	out := os.Stderr
+	_, _ = fmt.Fprintln(out, "")
+	_, _ = fmt.Fprintln(out, "Summary")
+	_, _ = fmt.Fprintf(out, "  Messages:   %d in %d page(s), limit %d\n", summary.messages, summary.pages, opts.Limit)
+	if summary.truncated {
+		_, _ = fmt.Fprintln(out, "  Truncated:  yes, fetching stopped before the last page, at the limit or on an error")
+	} else {
+		_, _ = fmt.Fprintln(out, "  Truncated:  no, every page was fetched")
+	}
+	if summary.messages == 0 {
+		return
+	}
+	if !summary.first.IsZero() {
+		_, _ = fmt.Fprintf(out, "  First:      %s\n", summary.first.Format(time.RFC3339))
+		_, _ = fmt.Fprintf(out, "  Last:       %s\n", summary.last.Format(time.RFC3339))
+	}
+	_, _ = fmt.Fprintf(out, "  Levels:     %s\n", formatCounts(topCounts(summary.levels, 0)))
+	_, _ = fmt.Fprintf(out, "  Services:   %s\n", formatCounts(topCounts(summary.services, summaryTopCount)))
+	_, _ = fmt.Fprintf(out, "  Hosts:      %s\n", formatCounts(topCounts(summary.hosts, summaryTopCount)))
+	_, _ = fmt.Fprintf(out, "  Classnames: %s\n", formatCounts(topCounts(summary.classnames, summaryTopCount)))
+}
+
+// Count one occurrence of a value, ignoring empty values.
+func increment(counts map[string]int, value string) {
+	if len(value) > 0 {
+		counts[value]++
+	}
+}
+
+// Sort the counts from largest to smallest and keep the first n (all of them when n is 0).
+func topCounts(counts map[string]int, n int) []summaryCount {
+	result := make([]summaryCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, summaryCount{name: name, count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count == result[j].count {
+			return result[i].name < result[j].name
+		}
+		return result[i].count > result[j].count
+	})
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// Format a list of counts as a single line.
+func formatCounts(counts []summaryCount) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%s %d", c.name, c.count)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"doglog/options"
+	"fmt"
+	"github.com/araddon/dateparse"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A relative time in Datadog date math, e.g. 'now-15m', '-2d' or '+1h'.
+var dateMathPattern = regexp.MustCompile(`^(now)?\s*(?:([+-])\s*(\d+)\s*([smhdw]))?$`)
+
+// A relative time in words, e.g. '2h ago' or '3 days ago'.
+var agoPattern = regexp.MustCompile(`^(\d+)\s*([a-z]+)\s+ago$`)
+
+// A day in words with an optional time of day, e.g. 'yesterday 14:00', 'today' or '9:30'.
+var dayPattern = regexp.MustCompile(`^(?:(today|yesterday)\s*)?(?:(\d{1,2}):(\d{2})(?::(\d{2}))?)?$`)
+
+// The units of the date math.
+var dateMathUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// The units of relative times in words, by their date math unit.
+var unitNames = map[string][]string{
+	"s": {"s", "sec", "secs", "second", "seconds"},
+	"m": {"m", "min", "mins", "minute", "minutes"},
+	"h": {"h", "hr", "hrs", "hour", "hours"},
+	"d": {"d", "day", "days"},
+	"w": {"w", "week", "weeks"},
+}
+
+// Unix timestamps in seconds have 10 digits and the ones in milliseconds 13, from 2001 to 2286. Other numbers, e.g.
+// 20240711, are left to dateparse.
+var epochPattern = regexp.MustCompile(`^(\d{10}|\d{13})$`)
+
+// Resolves the --start and --end values.
+type timeParser struct {
+	now      time.Time
+	location *time.Location
+	// Looks up the @markers of the [markers] section
+	markers func(name string) (string, bool)
+}
+
+// Resolve a --start or --end value into an absolute time, in the local timezone when it has none.
+func resolveTime(value string, now time.Time) (time.Time, error) {
+	t, _, err := timeParser{now: now, location: time.Local}.parse(value)
+	return t, err
+}
+
+// Parse a time: date math ('now-15m', '-2d'), a relative time in words ('2h ago'), a day and time ('yesterday
+// 14:00'), a unix timestamp in seconds or milliseconds, a @marker of the [markers] section, or a date in most common
+// formats, e.g. '2024-07-11 15:00' or 'July 11 2024 3pm'. Times without a timezone are in the parser's location.
+// The date math of a relative time is returned too, empty for absolute times.
+func (p timeParser) parse(value string) (time.Time, string, error) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	if len(value) == 0 {
+		return p.now, "now", nil
+	}
+
+	if m := dateMathPattern.FindStringSubmatch(lower); m != nil && (len(m[1]) > 0 || len(m[2]) > 0) {
+		if len(m[2]) == 0 {
+			return p.now, "now", nil
+		}
+		n, _ := strconv.Atoi(m[3])
+		return p.relative(m[2], n, m[4])
+	}
+
+	if m := agoPattern.FindStringSubmatch(lower); m != nil {
+		for unit, names := range unitNames {
+			if containsString(names, m[2]) {
+				n, _ := strconv.Atoi(m[1])
+				return p.relative("-", n, unit)
+			}
+		}
+		return time.Time{}, "", fmt.Errorf("unknown unit '%s' in '%s', use s, m, h, d or w", m[2], value)
+	}
+
+	if m := dayPattern.FindStringSubmatch(lower); m != nil {
+		now := p.now.In(p.location)
+		day := now.Day()
+		if m[1] == "yesterday" {
+			day--
+		}
+		// Built from the clock time rather than by adding to midnight, which is off by an hour on DST changes
+		hour, _ := strconv.Atoi(m[2])
+		minute, _ := strconv.Atoi(m[3])
+		second, _ := strconv.Atoi(m[4])
+		if hour > 23 || minute > 59 || second > 59 {
+			return time.Time{}, "", fmt.Errorf("invalid time of day in '%s'", value)
+		}
+		return time.Date(now.Year(), now.Month(), day, hour, minute, second, 0, p.location), "", nil
+	}
+
+	if epochPattern.MatchString(value) {
+		timestamp, _ := strconv.ParseInt(value, 10, 64)
+		if len(value) == 10 {
+			return time.Unix(timestamp, 0), "", nil
+		}
+		return time.UnixMilli(timestamp), "", nil
+	}
+
+	if name, ok := strings.CutPrefix(value, "@"); ok {
+		if p.markers == nil {
+			return time.Time{}, "", fmt.Errorf("unknown marker '%s'", value)
+		}
+		marker, ok := p.markers(name)
+		if !ok {
+			return time.Time{}, "", fmt.Errorf("unknown marker '%s', add it to the [markers] section", value)
+		}
+		if strings.HasPrefix(strings.TrimSpace(marker), "@") {
+			return time.Time{}, "", fmt.Errorf("the marker '%s' can't refer to another marker", value)
+		}
+		t, _, err := timeParser{now: p.now, location: p.location}.parse(marker)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid marker '%s' - %s", value, err)
+		}
+		return t, "", nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, "", nil
+	}
+	t, err := dateparse.ParseIn(value, p.location)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("can't understand the time '%s'", value)
+	}
+	return t, "", nil
+}
+
+// Resolve a time relative to now, and return it with its date math.
+func (p timeParser) relative(sign string, n int, unit string) (time.Time, string, error) {
+	offset := time.Duration(n) * dateMathUnits[unit]
+	if sign == "-" {
+		offset = -offset
+	}
+	return p.now.Add(offset), fmt.Sprintf("now%s%d%s", sign, n, unit), nil
+}
+
+// The layout of the absolute times sent to Datadog.
+const datadogTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// The layout of the resolved range echoed on stderr.
+const echoTimeLayout = "2006-01-02 15:04:05 MST"
+
+// Resolve the --start and --end values of the subcommand in the --timezone, so Datadog receives absolute times and
+// the range is checked before searching. Tailing keeps a relative --start, it moves with each poll. The resolved range
+// is echoed on stderr.
+func resolveRange(opts *options.Options) error {
+	switch {
+	case opts.Command == IndexesCommand, opts.Command == FormatsCommand && len(opts.Input) > 0:
+		return nil
+	}
+
+	location := time.Local
+	if len(opts.Timezone) > 0 {
+		var err error
+		if location, err = time.LoadLocation(opts.Timezone); err != nil {
+			return fmt.Errorf("unknown --timezone '%s' - %s", opts.Timezone, err)
+		}
+	}
+	p := timeParser{now: time.Now(), location: location, markers: opts.ServerConfig.Marker}
+
+	start, startMath, err := p.parse(opts.StartDate)
+	if err != nil {
+		return fmt.Errorf("invalid --start - %s", err)
+	}
+	switch opts.Command {
+	case TailCommand:
+		if len(startMath) == 0 {
+			return fmt.Errorf("tailing requires a relative --start, e.g., 'now-15m' or '15m ago', not '%s'", opts.StartDate)
+		}
+		opts.StartDate = startMath
+		_, _ = fmt.Fprintf(os.Stderr, "Tailing from %s (%s)\n", start.In(location).Format(echoTimeLayout), startMath)
+		return nil
+	case ServicesCommand:
+		// Keep the relative --start, the cache is only used for the default range
+		if len(startMath) > 0 {
+			opts.StartDate = startMath
+		} else {
+			opts.StartDate = start.UTC().Format(datadogTimeLayout)
+		}
+		return nil
+	}
+
+	end, _, err := p.parse(opts.EndDate)
+	if err != nil {
+		return fmt.Errorf("invalid --end - %s", err)
+	}
+	if !start.Before(end) {
+		return fmt.Errorf("--start %s is not before --end %s", start.In(location).Format(echoTimeLayout),
+			end.In(location).Format(echoTimeLayout))
+	}
+	opts.StartDate = start.UTC().Format(datadogTimeLayout)
+	opts.EndDate = end.UTC().Format(datadogTimeLayout)
+	if opts.Command != GetCommand {
+		_, _ = fmt.Fprintf(os.Stderr, "Searching from %s to %s (%s)\n", start.In(location).Format(echoTimeLayout),
+			end.In(location).Format(echoTimeLayout), end.Sub(start).Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"doglog/options"
+	"fmt"
+	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
+	"github.com/akamensky/argparse"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The time around a message shown by its permalink.
+const permalinkWindow = time.Minute
+
+// The flags of the open subcommand: the flags that select log messages, like search, and the end of the range.
+type openFlags struct {
+	scope *scopeFlags
+	end   *string
+}
+
+// Add the flags of the open subcommand.
+func addOpenFlags(cmd *argparse.Command) *openFlags {
+	return &openFlags{
+		scope: addScopeFlags(cmd),
+		end:   addEndFlag(cmd),
+	}
+}
+
+// Copy the open flags into the options.
+func (f *openFlags) apply(opts *options.Options) {
+	f.scope.apply(opts)
+	opts.EndDate = *f.end
+}
+
+// The host of the Datadog web application for the configured site, e.g. app.datadoghq.eu or us3.datadoghq.com.
+func appHost(opts *options.Options) string {
+	site := "datadoghq.com"
+	if opts.ServerConfig != nil && len(opts.ServerConfig.Site()) > 0 {
+		site = opts.ServerConfig.Site()
+	}
+	if strings.Count(site, ".") > 1 {
+		return site
+	}
+	return "app." + site
+}
+
+// Build the Log Explorer URL of a query, indexes and time range.
+func explorerUrl(opts *options.Options, query string, indexes []string, from time.Time, to time.Time) string {
+	params := url.Values{}
+	params.Set("query", query)
+	if len(indexes) > 0 && !containsString(indexes, "*") {
+		params.Set("index", strings.Join(indexes, ","))
+	}
+	params.Set("from_ts", strconv.FormatInt(from.UnixMilli(), 10))
+	params.Set("to_ts", strconv.FormatInt(to.UnixMilli(), 10))
+	params.Set("live", "false")
+	return "https://" + appHost(opts) + "/logs?" + params.Encode()
+}
+
+// SearchUrl Build the Log Explorer URL of the search: the computed query, the indexes and the time range, resolved to
+// absolute times so the link shows the same messages later.
+func SearchUrl(opts *options.Options) (string, error) {
+	now := time.Now()
+	from, err := resolveTime(opts.StartDate, now)
+	if err != nil {
+		return "", err
+	}
+	to, err := resolveTime(opts.EndDate, now)
+	if err != nil {
+		return "", err
+	}
+	return explorerUrl(opts, opts.Query, opts.Indexes, from, to), nil
+}
+
+// Build the permalink of a message: the Log Explorer, opened on the message.
+func messageUrl(opts *options.Options, msg datadogV2.Log) string {
+	id := msg.GetId()
+	if len(id) == 0 {
+		return ""
+	}
+	attributes := msg.GetAttributes()
+	timestamp := attributes.GetTimestamp()
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	params := url.Values{}
+	params.Set("event", id)
+	params.Set("from_ts", strconv.FormatInt(timestamp.Add(-permalinkWindow).UnixMilli(), 10))
+	params.Set("to_ts", strconv.FormatInt(timestamp.Add(permalinkWindow).UnixMilli(), 10))
+	params.Set("live", "false")
+	return "https://" + appHost(opts) + "/logs?" + params.Encode()
+}
+
+// CommandOpen Open the Log Explorer on the search in the default browser, and print its URL. Returns the exit code.
+func CommandOpen(opts *options.Options) int {
+	link, err := SearchUrl(opts)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't build the Log Explorer URL - %s\n", err)
+		return 1
+	}
+	fmt.Println(link)
+	if err := openBrowser(link); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't open the browser - %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// Open a URL in the default browser.
+func openBrowser(link string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	case "darwin":
+		cmd = exec.Command("open", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	return cmd.Start()
+}
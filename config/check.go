@@ -0,0 +1,334 @@
+package config
+
+import (
+	"bufio"
+	"doglog/consts"
+	"fmt"
+	"github.com/Masterminds/sprig/v3"
+	"gopkg.in/ini.v1"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// The value used in the example configuration for keys the user must fill in.
+const placeholderValue = "#ADDME#"
+
+// Severity of the problems found when checking the configuration.
+const (
+	ProblemError   = "error"
+	ProblemWarning = "warning"
+	ProblemInfo    = "info"
+)
+
+// The sections doglog understands.
+var knownSections = []string{ini.DefaultSection, serverSection, fieldSection, computedSection, levelsSection,
+	levelColorsSection, formatsSection, longFormatsSection, markersSection}
+
+// The keys doglog understands, by section. Sections that aren't listed accept any key.
+var knownKeys = map[string][]string{
+	ini.DefaultSection: {includeKey},
+	serverSection: {apiKey, applicationKey, apiKeyCommand, applicationKeyCommand, siteKey, secretsFileKey,
+		secretsKeyFileKey, strictPermissionsKey},
+}
+
+// Fields that doglog fills in itself. Mapping them in the [fields] section has no effect or hides the original value.
+var builtInFields = []string{
+	consts.DatadogStatus, consts.DatadogService, consts.DatadogHost, consts.DatadogTimestamp, consts.DatadogMessage,
+	consts.ComputedJsonField, consts.ComputedShortClassnameField, consts.ComputedTypedField, consts.ComputedUrlField,
+	consts.LevelColorField, consts.BlueField, consts.RedField, consts.GreenField, consts.YellowField,
+	consts.GreyField, consts.WhiteField, consts.CyanField, consts.MagentaField, consts.ResetField,
+}
+
+// Problem describes something wrong (or suspicious) in the configuration file.
+type Problem struct {
+	// File is the configuration file that defines the section or key. Empty when unknown.
+	File    string
+	Level   string
+	Section string
+	Key     string
+	// Line and Column locate the problem in the configuration file. Zero when unknown.
+	Line    int
+	Column  int
+	Message string
+}
+
+// String formats the problem for display.
+func (p Problem) String() string {
+	var location string
+	if p.Line > 0 {
+		location = fmt.Sprintf("%s:%d:%d: ", p.File, p.Line, p.Column)
+	} else if len(p.File) > 0 {
+		location = p.File + ": "
+	}
+	var key string
+	if len(p.Key) > 0 {
+		key = fmt.Sprintf("[%s] %s: ", p.Section, p.Key)
+	} else if len(p.Section) > 0 {
+		key = fmt.Sprintf("[%s]: ", p.Section)
+	}
+	return fmt.Sprintf("%s%s: %s%s", location, p.Level, key, p.Message)
+}
+
+// Position of a key (or section header) in the configuration file.
+type position struct {
+	file   string
+	line   int
+	column int
+	value  string
+}
+
+// Check validates the configuration files and returns every problem found: unknown sections and keys, missing keys,
+// format templates that don't compile and field mappings that shadow doglog's own fields.
+func (c *IniFile) Check() []Problem {
+	positions := c.positions()
+	var problems []Problem
+	add := func(level string, section string, key string, message string) {
+		p := Problem{Level: level, Section: section, Key: key, Message: message}
+		if pos, ok := positions[section+"\x00"+key]; ok {
+			p.File, p.Line, p.Column = pos.file, pos.line, pos.column
+		}
+		problems = append(problems, p)
+	}
+
+	for _, section := range c.ini.Sections() {
+		name := section.Name()
+		if !contains(knownSections, name) && !isFormatOverride(name) {
+			add(ProblemWarning, name, "", "unknown section")
+			continue
+		}
+		if keys, ok := knownKeys[name]; ok {
+			for _, k := range section.Keys() {
+				if !contains(keys, k.Name()) {
+					add(ProblemWarning, name, k.Name(), "unknown key")
+				}
+			}
+		}
+	}
+
+	for _, warning := range c.projectWarnings {
+		problems = append(problems, Problem{Level: ProblemWarning, Message: warning})
+	}
+
+	server := c.ini.Section(serverSection)
+	for _, key := range [][]string{{apiKey, apiKeyCommand}, {applicationKey, applicationKeyCommand}} {
+		pos, found := positions[serverSection+"\x00"+key[0]]
+		if found && pos.value == placeholderValue {
+			add(ProblemError, serverSection, key[0], "still set to the "+placeholderValue+" placeholder")
+		} else if len(server.Key(key[0]).String()) == 0 && len(server.Key(key[1]).String()) == 0 && len(c.SecretsFile()) == 0 {
+			add(ProblemError, serverSection, key[0], "missing (set either "+key[0]+" or "+key[1]+", or use 'doglog secrets set')")
+		}
+	}
+	if path := server.Key(secretsFileKey).String(); len(path) > 0 {
+		if _, err := os.Stat(expandHome(path)); err != nil {
+			add(ProblemError, serverSection, secretsFileKey, "the secrets file can't be read - "+err.Error())
+		}
+	}
+	if len(c.insecurePaths) > 0 {
+		level := ProblemWarning
+		if c.StrictPermissions() {
+			level = ProblemError
+		}
+		problems = append(problems, Problem{Level: level, Message: permissionMessage(c.insecurePaths)})
+	}
+	if keyFile := c.SecretsKeyFile(); len(keyFile) > 0 && readableByOthers(keyFile) {
+		level := ProblemWarning
+		if c.StrictPermissions() {
+			level = ProblemError
+		}
+		problems = append(problems, Problem{Level: level, Message: keyFileMessage(keyFile)})
+	}
+	if site := server.Key(siteKey).String(); len(site) > 0 && !contains(knownSites, site) {
+		add(ProblemWarning, serverSection, siteKey, "not one of the known Datadog sites: "+strings.Join(knownSites, ", "))
+	}
+
+	checkTemplates := func(sectionName string) {
+		for _, k := range c.ini.Section(sectionName).Keys() {
+			if err := checkTemplate(k.Name(), k.Value()); err != nil {
+				p := Problem{Level: ProblemError, Section: sectionName, Key: k.Name(), Message: err.message}
+				if pos, ok := positions[sectionName+"\x00"+k.Name()]; ok {
+					p.File, p.Line, p.Column = pos.file, pos.line, pos.column+err.offset
+				}
+				problems = append(problems, p)
+			}
+		}
+	}
+	for _, sectionName := range []string{formatsSection, longFormatsSection} {
+		if !c.ini.HasSection(sectionName) || len(c.ini.Section(sectionName).Keys()) == 0 {
+			add(ProblemWarning, sectionName, "", "no formats defined, messages will be displayed as json")
+			continue
+		}
+		checkTemplates(sectionName)
+	}
+	for _, section := range c.ini.Sections() {
+		if isFormatOverride(section.Name()) {
+			checkTemplates(section.Name())
+		}
+	}
+	checkTemplates(computedSection)
+
+	defaults := defaultFields()
+	for _, k := range c.ini.Section(fieldSection).Keys() {
+		if contains(builtInFields, k.Name()) {
+			add(ProblemWarning, fieldSection, k.Name(), "shadows a field computed by doglog, the mapping will be overwritten")
+		} else if d, ok := defaults[k.Name()]; ok && strings.Join(d, ",") != strings.Join(splitList(k.Value()), ",") {
+			add(ProblemInfo, fieldSection, k.Name(), "replaces the built-in mapping "+strings.Join(defaults[k.Name()], ", "))
+		}
+	}
+
+	levels := c.Levels()
+	for _, k := range c.ini.Section(levelColorsSection).Keys() {
+		if _, ok := colorNames[strings.ToLower(k.Value())]; !ok {
+			add(ProblemError, levelColorsSection, k.Name(), "unknown color '"+k.Value()+"', use one of grey, red, green, yellow, blue, magenta, cyan, white, none")
+		} else if _, ok := levels.Severity(strings.ToUpper(k.Name())); !ok {
+			add(ProblemWarning, levelColorsSection, k.Name(), "not one of the levels: "+strings.Join(levels.Names(), ", "))
+		}
+	}
+
+	fields := c.Fields()
+	for _, k := range c.ini.Section(computedSection).Keys() {
+		if contains(builtInFields, k.Name()) {
+			add(ProblemWarning, computedSection, k.Name(), "shadows a field computed by doglog")
+		} else if _, ok := fields[k.Name()]; ok {
+			add(ProblemWarning, computedSection, k.Name(), "replaces the value of the field mapping of the same name")
+		}
+	}
+
+	return problems
+}
+
+// Check whether a section holds the formats for a service, source or tag, e.g. [formats.short.checkout].
+func isFormatOverride(section string) bool {
+	for _, base := range []string{formatsSection, longFormatsSection} {
+		if name, ok := strings.CutPrefix(section, base+"."); ok && len(name) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// A template that failed to compile. The offset is the position of the error within the template text.
+type templateError struct {
+	message string
+	offset  int
+}
+
+// Compile a template the same way it is compiled for display and report where it fails.
+func checkTemplate(name string, text string) *templateError {
+	if _, err := ParseTemplate(name, text); err == nil {
+		return nil
+	} else {
+		return &templateError{message: TrimTemplateError(name, err), offset: templateErrorOffset(name, text)}
+	}
+}
+
+// ParseTemplate parses a format template with the functions and options used for display.
+func ParseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(sprig.TxtFuncMap()).Option("missingkey=error").Parse(text)
+}
+
+// TrimTemplateError Remove the "template: name:1:" prefix from a template error.
+func TrimTemplateError(name string, err error) string {
+	message := err.Error()
+	prefix := "template: " + name + ":"
+	if strings.HasPrefix(message, prefix) {
+		message = message[len(prefix):]
+		if i := strings.Index(message, ": "); i >= 0 {
+			message = message[i+2:]
+		}
+	}
+	return message
+}
+
+// The template parser only reports line numbers, so find the first action that makes the template fail by parsing
+// ever longer prefixes of it. Errors that are only detected at the end (e.g. a missing {{end}}) point past the text.
+func templateErrorOffset(name string, text string) int {
+	start := 0
+	for {
+		open := strings.Index(text[start:], "{{")
+		if open < 0 {
+			break
+		}
+		open += start
+		end := strings.Index(text[open:], "}}")
+		if end < 0 {
+			return open
+		}
+		end += open + 2
+		if _, err := ParseTemplate(name, text[:end]); err != nil && !isIncompleteTemplate(err) {
+			return open
+		}
+		start = end
+	}
+	return len(text)
+}
+
+// Check whether a template failed only because it was cut off, e.g. an {{if}} without its {{end}}.
+func isIncompleteTemplate(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "unexpected EOF") || strings.Contains(message, "unclosed action")
+}
+
+// Find the file, line and column of every section header and key in the configuration files. Keys are indexed by
+// "section\x00key", section headers by "section\x00". When several files define a key, the last one wins.
+func (c *IniFile) positions() map[string]position {
+	positions := make(map[string]position)
+	for _, path := range c.paths {
+		switch {
+		case isYamlFile(path):
+			yamlPositions(path, positions)
+		case isTomlFile(path):
+			tomlPositions(path, positions)
+		default:
+			filePositions(path, positions)
+		}
+	}
+	return positions
+}
+
+// Add the positions of the section headers and keys of a single INI configuration file.
+func filePositions(path string, positions map[string]position) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	section := ini.DefaultSection
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		indent := len(text) - len(strings.TrimLeft(text, " \t"))
+		switch {
+		case len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			if _, ok := positions[section+"\x00"]; !ok {
+				positions[section+"\x00"] = position{file: path, line: line, column: indent + 1}
+			}
+		default:
+			i := strings.IndexAny(text, "=:")
+			if i < 0 {
+				continue
+			}
+			key := strings.TrimSpace(text[:i])
+			valueStart := i + 1
+			for valueStart < len(text) && (text[valueStart] == ' ' || text[valueStart] == '\t') {
+				valueStart++
+			}
+			positions[section+"\x00"+key] = position{file: path, line: line, column: valueStart + 1, value: strings.TrimSpace(text[valueStart:])}
+		}
+	}
+}
+
+// Check whether a list of strings contains a value.
+func contains(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -6,18 +6,25 @@ import (
 	"github.com/DataDog/datadog-api-client-go/v2/api/datadogV2"
 	"gopkg.in/ini.v1"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
 const NoFormatDefined = "No Formats Defined>>"
 
+const formatsSectionPrefix string = "formats."
 const formatsSection string = "formats.short"    // [formats]
 const longFormatsSection string = "formats.long" // [formats.long]
 const serverSection string = "server"            // [server]
 const fieldSection string = "fields"             // [fields]
+const computedSection string = "computed"        // [computed]
 const apiKey = "api-key"
 const applicationKey = "application-key"
+const apiKeyCommand = "api-key-command"
+const applicationKeyCommand = "application-key-command"
+const siteKey = "site"
 
 // FormatDefinition stores a single format line.
 type FormatDefinition struct {
@@ -28,35 +35,143 @@ type FormatDefinition struct {
 // IniFile is a wrapper around the INI file reader
 type IniFile struct {
 	ini *ini.File
+	// The files that were merged, from least-specific to most-specific
+	paths []string
 	// Stores formats so we don't keep re-reading them
 	storedFormats []FormatDefinition
+	// Stores the formats used for messages with per-service, per-source or per-tag formats, by override sections
+	storedMessageFormats map[string][]FormatDefinition
 	// Stores field mappings so we don't keep re-reading them
 	storedFields map[string][]string
+	// Stores the computed field templates so we don't keep re-reading them
+	storedComputed []FormatDefinition
+	// Stores the level mappings so we don't keep re-reading them
+	storedLevels *Levels
+	// Stores the keys produced by the key commands so the commands only run once
+	storedKeys map[string]string
+	// Stores the keys from the secrets file so it is only unlocked once
+	storedSecrets map[string]string
+	// The files holding keys that other users can read
+	insecurePaths []string
+	// The keys and includes of the project files that were ignored
+	projectWarnings []string
 }
 
-// New creates a new INI file reader and wraps it.
-func New(configPath string) (*IniFile, error) {
-	if f, err := readConfig(configPath); err == nil {
-		return &IniFile{ini: f}, nil
-	} else {
+// New creates a new INI file reader and wraps it. When more than one configuration file is given, the files are
+// merged with later files overriding the keys of earlier ones. Files named by an 'include' directive are merged
+// right before the file that includes them.
+func New(configPaths ...string) (*IniFile, error) {
+	paths, project, warnings, err := expandIncludes(configPaths)
+	if err != nil {
 		return nil, err
 	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no configuration file found")
+	}
+
+	files := make([]*ini.File, len(paths))
+	for i, path := range paths {
+		if files[i], err = readConfig(path); err != nil {
+			return nil, err
+		}
+		if containsPath(project, path) {
+			warnings = append(warnings, dropServerKeys(path, files[i])...)
+		}
+	}
+	return &IniFile{ini: mergeConfigs(files), paths: paths, insecurePaths: insecureFiles(paths, files),
+		projectWarnings: warnings}, nil
 }
 
 func (c *IniFile) AllFields() map[string][]string {
 	return c.storedFields
 }
 
-// ApiKey gets the API key from the config file. Defaults to an empty string.
+// ApiKey gets the API key from the config file, or from the output of the api-key-command. Defaults to an empty
+// string.
 func (c *IniFile) ApiKey() string {
-	server := c.ini.Section(serverSection)
-	return server.Key(apiKey).MustString("")
+	return c.key(apiKey, apiKeyCommand)
 }
 
-// ApplicationKey gets the application key from the config file. Defaults to an empty string.
+// ApplicationKey gets the application key from the config file, or from the output of the application-key-command.
+// Defaults to an empty string.
 func (c *IniFile) ApplicationKey() string {
+	return c.key(applicationKey, applicationKeyCommand)
+}
+
+// Site gets the Datadog site, e.g. datadoghq.eu, from the config file. Defaults to an empty string, which means the
+// Datadog client's default site.
+func (c *IniFile) Site() string {
 	server := c.ini.Section(serverSection)
-	return server.Key(applicationKey).MustString("")
+	return server.Key(siteKey).MustString("")
+}
+
+// Get a key from the server section. When the key isn't set, look in the encrypted secrets file, then run the
+// matching command (e.g. a password manager lookup) and use its output instead.
+func (c *IniFile) key(name string, commandName string) string {
+	server := c.ini.Section(serverSection)
+	if value := server.Key(name).MustString(""); len(value) > 0 {
+		return value
+	}
+	if value, ok := c.secret(name); ok {
+		return value
+	}
+	command := server.Key(commandName).MustString("")
+	if len(command) == 0 {
+		return ""
+	}
+	if value, ok := c.storedKeys[name]; ok {
+		return value
+	}
+	value, err := runKeyCommand(command)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Can't get the %s from '%s' - %s\n", name, command, err)
+	}
+	if c.storedKeys == nil {
+		c.storedKeys = make(map[string]string)
+	}
+	c.storedKeys[name] = value
+	return value
+}
+
+// KeepServer Use the [server] section of a previous configuration, with the keys it already got from the key commands
+// and the secrets file. Reloading the configuration then never runs a key command or asks for the passphrase again.
+func (c *IniFile) KeepServer(previous *IniFile) {
+	c.ini.DeleteSection(serverSection)
+	server := c.ini.Section(serverSection)
+	for _, k := range previous.ini.Section(serverSection).Keys() {
+		_, _ = server.NewKey(k.Name(), k.Value())
+	}
+	c.storedKeys = copyMap(previous.storedKeys)
+	c.storedSecrets = copyMap(previous.storedSecrets)
+}
+
+// Copy a map of strings. A nil map stays nil.
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// Run a command with the user's shell and return the first line of its output.
+func runKeyCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	value, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimSpace(value), nil
 }
 
 // Formats gets the log messages formats from the config file. Adds a final default format case so the user knows that
@@ -78,70 +193,172 @@ func (c *IniFile) Formats(useLong bool) []FormatDefinition {
 	return c.storedFormats
 }
 
+// The prefixes of the override sections that select formats by the message's source or tags, e.g.
+// [formats.short.source:nginx] or [formats.long.tag:env:staging]. Any other suffix, e.g. [formats.short.checkout], is a
+// service name.
+const sourceOverridePrefix = "source:"
+const tagOverridePrefix = "tag:"
+
+// MessageFormats gets the formats to try for a message. The formats of the override sections for the message's
+// service, tags and source, e.g. [formats.short.checkout], [formats.short.tag:env:staging] and
+// [formats.short.source:nginx], are tried in that order before the generic formats.
+func (c *IniFile) MessageFormats(useLong bool, service string, source string, tags []string) []FormatDefinition {
+	base := formatsSection
+	if useLong {
+		base = longFormatsSection
+	}
+	var candidates []string
+	if len(service) > 0 {
+		candidates = append(candidates, base+"."+service)
+	}
+	for _, tag := range tags {
+		candidates = append(candidates, base+"."+tagOverridePrefix+tag)
+	}
+	if len(source) > 0 {
+		candidates = append(candidates, base+"."+sourceOverridePrefix+source)
+	}
+
+	var sections []string
+	for _, name := range candidates {
+		if c.ini.HasSection(name) && !contains(sections, name) {
+			sections = append(sections, name)
+		}
+	}
+	if len(sections) == 0 {
+		return c.Formats(useLong)
+	}
+
+	cacheKey := strings.Join(sections, "\x00")
+	if formats, ok := c.storedMessageFormats[cacheKey]; ok {
+		return formats
+	}
+	var formats []FormatDefinition
+	for _, name := range sections {
+		for _, f := range c.ini.Section(name).Keys() {
+			formats = append(formats, FormatDefinition{Name: name[len(base)+1:] + "/" + f.Name(), Format: f.Value()})
+		}
+	}
+	formats = append(formats, c.Formats(useLong)...)
+	if c.storedMessageFormats == nil {
+		c.storedMessageFormats = make(map[string][]FormatDefinition)
+	}
+	c.storedMessageFormats[cacheKey] = formats
+	return formats
+}
+
 // Fields gets the field mappings from the config file. These will be merged with the defaults.
 func (c *IniFile) Fields() map[string][]string {
 	if c.storedFields == nil {
-		c.storedFields = make(map[string][]string)
-		c.storedFields[consts.ComputedLevelField] =
-			[]string{consts.DatadogStatus, "level", "status", "loglevel", "log_status", "LogLevel", "severity"}
-		c.storedFields[consts.ComputedMessageField] =
-			[]string{consts.DatadogMessage, "message", "msg", "textPayload", "Message"}
-		c.storedFields[consts.ComputedClassNameField] =
-			[]string{"classname", "logger_name", "LoggerName", "component", "name"}
-		c.storedFields[consts.ComputedThreadNameField] =
-			[]string{"threadname", "thread_name"}
-		c.storedFields[consts.ComputedTimestampField] =
-			[]string{consts.DatadogTimestamp, "timestamp"}
+		c.storedFields = defaultFields()
 
 		for _, f := range c.ini.Section(fieldSection).Keys() {
-			name := f.Name()
-			value := f.Value()
-			fieldList := strings.Split(value, ",")
-			for i := range fieldList {
-				fieldList[i] = strings.TrimSpace(fieldList[i])
-			}
-			c.storedFields[name] = fieldList
+			c.storedFields[f.Name()] = splitList(f.Value())
 		}
 	}
 
 	return c.storedFields
 }
 
+// ComputedFields gets the computed field definitions from the config file, in the order they are evaluated. Each
+// definition is a template over the fields of the message, including the computed fields defined before it.
+func (c *IniFile) ComputedFields() []FormatDefinition {
+	if c.storedComputed == nil {
+		c.storedComputed = []FormatDefinition{}
+		for _, f := range c.ini.Section(computedSection).Keys() {
+			c.storedComputed = append(c.storedComputed, FormatDefinition{Name: f.Name(), Format: f.Value()})
+		}
+	}
+
+	return c.storedComputed
+}
+
+// The built-in field mappings.
+func defaultFields() map[string][]string {
+	fields := make(map[string][]string)
+	fields[consts.ComputedLevelField] =
+		[]string{consts.DatadogStatus, "level", "status", "loglevel", "log_status", "LogLevel", "severity"}
+	fields[consts.ComputedMessageField] =
+		[]string{consts.DatadogMessage, "message", "msg", "textPayload", "Message"}
+	fields[consts.ComputedClassNameField] =
+		[]string{"classname", "logger_name", "LoggerName", "component", "name"}
+	fields[consts.ComputedThreadNameField] =
+		[]string{"threadname", "thread_name"}
+	fields[consts.ComputedTimestampField] =
+		[]string{consts.DatadogTimestamp, "timestamp"}
+	return fields
+}
+
+// Paths returns the locations of the configuration files that were merged, from least-specific to most-specific.
+func (c *IniFile) Paths() []string {
+	return c.paths
+}
+
+// AggregateFields sets every mapped field (e.g. __level) from the first of its source fields found in the message.
+// The mapped fields are strings; their original typed values are kept in the __typed map.
 func (c *IniFile) AggregateFields(msg datadogV2.Log) {
 	if msg.AdditionalProperties != nil {
 		fieldMappings := c.Fields()
+		typed := make(map[string]interface{}, len(fieldMappings))
 		for k := range fieldMappings {
-			if value, ok := c.MapField(msg, k); ok {
-				msg.AdditionalProperties[k] = value
+			if value, ok := c.MapValue(msg, k); ok {
+				msg.AdditionalProperties[k], _ = FieldString(value)
+				typed[k] = value
 			}
 		}
+		msg.AdditionalProperties[consts.ComputedTypedField] = typed
 	}
 }
 
-// MapField Pull a field from the 'fields' map, using field mappings as available
+// MapField Pull a field from the 'fields' map, using field mappings as available. Non-string values are converted
+// to strings.
 func (c *IniFile) MapField(msg datadogV2.Log, field string) (string, bool) {
+	if value, ok := c.MapValue(msg, field); ok {
+		return FieldString(value)
+	}
+	return "", false
+}
+
+// MapValue Pull the typed value of a field, using field mappings as available. Source fields are looked up in the
+// flattened message first, then as dotted paths into the original nested attributes.
+func (c *IniFile) MapValue(msg datadogV2.Log, field string) (interface{}, bool) {
+	_, value, ok := c.MappedSource(msg, field)
+	return value, ok
+}
+
+// MappedSource Find the source field that supplies a field through the field mappings, with its typed value.
+func (c *IniFile) MappedSource(msg datadogV2.Log, field string) (string, interface{}, bool) {
 	fieldMappings := c.Fields()
 	fieldList, ok := fieldMappings[field]
 	if !ok {
-		fieldList = make([]string, 1)
-		fieldList[0] = field
+		fieldList = []string{field}
 	}
 
 	for _, f := range fieldList {
-		if value, ok := msg.AdditionalProperties[f]; ok {
-			switch value.(type) {
-			case string:
-				return value.(string), true
-			case *string:
-				return *(value.(*string)), true
+		if value, ok := msg.AdditionalProperties[f]; ok && value != nil {
+			if _, ok := FieldString(value); ok {
+				return f, value, true
+			}
+		}
+		if msg.Attributes != nil && strings.Contains(f, ".") {
+			if value, ok := LookupPath(msg.Attributes.Attributes, f); ok && value != nil {
+				return f, value, true
 			}
-			return value.(string), true
 		}
 	}
-	return "", false
+	return "", nil, false
 }
 
-// Reads the configuration file. The configuration is stored in a INI style file.
+// Split a comma-separated list of values, trimming the whitespace around each value.
+func splitList(value string) []string {
+	list := strings.Split(value, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	return list
+}
+
+// Reads the configuration file. The configuration is stored in a INI style file, or in a YAML or TOML file with the
+// same sections when the file has a .yaml, .yml or .toml extension.
 func readConfig(configPath string) (*ini.File, error) {
 	configPath, err := filepath.Abs(configPath)
 	if err != nil {
@@ -152,7 +369,15 @@ func readConfig(configPath string) (*ini.File, error) {
 		return nil, fmt.Errorf("configuration file not found or not readable at %s - %s", configPath, err2)
 	}
 
-	cfg, err := ini.Load(configPath)
+	var cfg *ini.File
+	switch {
+	case isYamlFile(configPath):
+		cfg, err = readYamlConfig(configPath)
+	case isTomlFile(configPath):
+		cfg, err = readTomlConfig(configPath)
+	default:
+		cfg, err = ini.Load(configPath)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("configuration file cannot be parsed at %s - %s", configPath, err)
 	}
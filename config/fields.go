@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FieldString converts a field value into the string used for display. Numbers are printed without exponents or
+// trailing zeros, lists and objects are printed as JSON. Returns false for missing (nil) values.
+func FieldString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case *string:
+		if v == nil {
+			return "", false
+		}
+		return *v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case int:
+		return strconv.Itoa(v), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}, map[string]interface{}:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v), true
+		}
+		return string(buf), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// LookupPath finds a value in nested attributes using a dotted path, e.g. 'http.request.headers.x-request-id'.
+// Attribute names may contain dots themselves, so the longest matching name is tried first at each level. List
+// elements are selected with a numeric index, e.g. 'tags.0'.
+func LookupPath(attributes map[string]interface{}, path string) (interface{}, bool) {
+	if value, ok := attributes[path]; ok {
+		return value, true
+	}
+	parts := strings.Split(path, ".")
+	for i := len(parts) - 1; i > 0; i-- {
+		name := strings.Join(parts[:i], ".")
+		value, ok := attributes[name]
+		if !ok {
+			continue
+		}
+		rest := strings.Join(parts[i:], ".")
+		switch child := value.(type) {
+		case map[string]interface{}:
+			if found, ok := LookupPath(child, rest); ok {
+				return found, true
+			}
+		case []interface{}:
+			index, tail, _ := strings.Cut(rest, ".")
+			n, err := strconv.Atoi(index)
+			if err != nil || n < 0 || n >= len(child) {
+				continue
+			}
+			if len(tail) == 0 {
+				return child[n], true
+			}
+			if m, ok := child[n].(map[string]interface{}); ok {
+				if found, ok := LookupPath(m, tail); ok {
+					return found, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"doglog/consts"
+	"fmt"
+	"strings"
+)
+
+// The Datadog sites, the first one being the default.
+var knownSites = []string{
+	"datadoghq.com",
+	"us3.datadoghq.com",
+	"us5.datadoghq.com",
+	"ap1.datadoghq.com",
+	"datadoghq.eu",
+	"ddog-gov.com",
+}
+
+// KnownSites returns the Datadog sites, the first one being the default.
+func KnownSites() []string {
+	return knownSites
+}
+
+// FormatPack is a set of starter formats for a common kind of log.
+type FormatPack struct {
+	Name        string
+	Description string
+	Short       []FormatDefinition
+	Long        []FormatDefinition
+}
+
+// The starter format packs, from most-specific to least-specific. Formats are tried in this order, so formats that
+// need unusual fields come before the generic ones.
+var formatPacks = []FormatPack{
+	{
+		Name:        "nginx",
+		Description: "nginx access logs (Datadog nginx pipeline)",
+		Short: []FormatDefinition{
+			{Name: "nginx", Format: `{{.__timestamp}} {{._Level_color}}{{.status_code | printf "%3.0f"}}{{._Reset}} {{.method | printf "%-6.6s"}} {{.url}} {{.ip}}`},
+		},
+		Long: []FormatDefinition{
+			{Name: "nginx", Format: `{{.__timestamp}} {{.__service | printf "%-20.20s"}} {{._Level_color}}{{.status_code | printf "%3.0f"}}{{._Reset}} {{.method | printf "%-6.6s"}} {{.url}} {{.ip}} {{.useragent}}`},
+		},
+	},
+	{
+		Name:        "go",
+		Description: "Go services using zap",
+		Short: []FormatDefinition{
+			{Name: "zap", Format: `{{.__timestamp}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} {{.caller | printf "%-30.30s"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+		},
+		Long: []FormatDefinition{
+			{Name: "zap", Format: `{{.__timestamp}} {{.__service | printf "%-20.20s"}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} {{.caller | printf "%-30.30s"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+		},
+	},
+	{
+		Name:        "node",
+		Description: "Node.js services using pino",
+		Short: []FormatDefinition{
+			{Name: "pino", Format: `{{.__timestamp}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} {{.pid | printf "%-6.0f"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+		},
+		Long: []FormatDefinition{
+			{Name: "pino", Format: `{{.__timestamp}} {{.__service | printf "%-20.20s"}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} {{.hostname | printf "%-20.20s"}} {{.pid | printf "%-6.0f"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+		},
+	},
+	{
+		Name:        "java",
+		Description: "Java services using logback/logstash",
+		Short: []FormatDefinition{
+			{Name: "java1", Format: `{{.__timestamp}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} {{.__short_classname | printf "%-30.30s"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+		},
+		Long: []FormatDefinition{
+			{Name: "java1", Format: `{{.__timestamp}} {{.__service | printf "%-20.20s"}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} [{{.__threadname | printf "%-20.20s"}}] {{.__short_classname | printf "%-30.30s"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+			{Name: "java2", Format: `{{.__timestamp}} {{.__service | printf "%-20.20s"}} {{._Level_color}}{{.__level | printf "%-5.5s"}}{{._Reset}} {{.__short_classname | printf "%-30.30s"}} -- {{._Level_color}}{{.__message}}{{._Reset}}`},
+		},
+	},
+}
+
+// The formats that are always added last so every message with a timestamp and a message gets displayed.
+var minimalFormats = FormatPack{
+	Short: []FormatDefinition{
+		{Name: "minimal", Format: `{{.__timestamp}} {{._Level_color}}{{.__level | printf "%-5.5s"}} {{.__message}}{{._Reset}}`},
+	},
+	Long: []FormatDefinition{
+		{Name: "minimal", Format: `{{.__timestamp}} {{.__service | printf "%-20.20s"}} {{._Level_color}}{{.__level | printf "%-5.5s"}} {{.__message}}{{._Reset}}`},
+	},
+}
+
+// FormatPacks returns the starter format packs.
+func FormatPacks() []FormatPack {
+	return formatPacks
+}
+
+// Settings holds the answers used to generate a new configuration file.
+type Settings struct {
+	Site                  string
+	ApiKey                string
+	ApplicationKey        string
+	ApiKeyCommand         string
+	ApplicationKeyCommand string
+	// Packs are the names of the format packs to include.
+	Packs []string
+}
+
+// Generate creates the text of a commented configuration file.
+func Generate(settings Settings) string {
+	var sb strings.Builder
+	line := func(format string, a ...any) {
+		_, _ = fmt.Fprintf(&sb, format+"\n", a...)
+	}
+
+	line("# doglog configuration. Run 'doglog config check' after editing this file.")
+	line("")
+	line("[%s]", serverSection)
+	line("# The Datadog site: %s", strings.Join(knownSites, ", "))
+	if len(settings.Site) > 0 {
+		line("%s = %s", siteKey, settings.Site)
+	} else {
+		line("# %s = %s", siteKey, knownSites[0])
+	}
+	line("# Either store the keys in this file, or give a command that prints the key, e.g. a password manager lookup.")
+	keyLines := func(key string, value string, commandKey string, command string) {
+		switch {
+		case len(command) > 0:
+			line("%s = %s", commandKey, command)
+		case len(value) > 0:
+			line("%s = %s", key, value)
+		default:
+			line("%s = %s", key, placeholderValue)
+		}
+	}
+	keyLines(apiKey, settings.ApiKey, apiKeyCommand, settings.ApiKeyCommand)
+	keyLines(applicationKey, settings.ApplicationKey, applicationKeyCommand, settings.ApplicationKeyCommand)
+	line("# Or store them encrypted with 'doglog secrets set api-key' (defaults to ~/.doglog.secrets)")
+	line("# %s = ~/.doglog.secrets", secretsFileKey)
+	line("# %s = ~/.config/doglog/key", secretsKeyFileKey)
+	line("# Refuse to run when this file holds keys and can be read by other users")
+	line("# %s = true", strictPermissionsKey)
+	line("")
+	line("# Fields from Datadog")
+	line("# %s", consts.DatadogStatus)
+	line("# %s", consts.DatadogService)
+	line("# %s", consts.DatadogHost)
+	line("# %s", consts.DatadogTimestamp)
+	line("# %s", consts.DatadogMessage)
+	line("")
+	line("# Computed fields")
+	line("# %s - normalized and uppercased", consts.ComputedLevelField)
+	line("# %s", consts.ComputedMessageField)
+	line("# %s", consts.ComputedJsonField)
+	line("# %s", consts.ComputedClassNameField)
+	line("# %s", consts.ComputedShortClassnameField)
+	line("# %s", consts.ComputedThreadNameField)
+	line("# %s", consts.ComputedTimestampField)
+	line("")
+	line("# Each computed field is taken from the first of the listed fields found in the message. These are the")
+	line("# default definitions built into doglog, you don't have to define them if you don't need to alter them.")
+	line("[%s]", fieldSection)
+	defaults := defaultFields()
+	for _, field := range []string{consts.ComputedLevelField, consts.ComputedMessageField, consts.ComputedClassNameField,
+		consts.ComputedThreadNameField, consts.ComputedTimestampField} {
+		line("%s = %s", field, strings.Join(defaults[field], ", "))
+	}
+	line("__service = %s, service", consts.DatadogService)
+	line("")
+	line("# Optional mappings of the levels found in messages to the normalized levels: exact names, prefixes ending in '*'")
+	line("# and numeric ranges. The built-in levels are %s.", strings.Join(defaultLevelOrder, ", "))
+	line("[%s]", levelsSection)
+	line("# WARN = warnung, 35-39")
+	line("# order = %s", strings.Join(defaultLevelOrder, ", "))
+	line("")
+	line("# Optional colors of the levels: grey, red, green, yellow, blue, magenta, cyan, white or none.")
+	line("[%s]", levelColorsSection)
+	line("# NOTICE = cyan")
+	line("")
+	line("# Optional fields defined by templates over the other fields, evaluated in order.")
+	line("[%s]", computedSection)
+	line("# latency_ms = {{ div .duration 1000000 }}")
+	line("")
+	line("# Times used with --start and --end as @name, e.g. 'doglog -s my-service --start @deploy'.")
+	line("[%s]", markersSection)
+	line("# deploy = 2024-07-11 15:00")
+
+	var packs []FormatPack
+	for _, p := range formatPacks {
+		if contains(settings.Packs, p.Name) {
+			packs = append(packs, p)
+		}
+	}
+	packs = append(packs, minimalFormats)
+
+	for _, section := range []struct {
+		name    string
+		formats func(p FormatPack) []FormatDefinition
+	}{
+		{formatsSection, func(p FormatPack) []FormatDefinition { return p.Short }},
+		{longFormatsSection, func(p FormatPack) []FormatDefinition { return p.Long }},
+	} {
+		line("")
+		line("# Formats are tried in order, from most-specific to least-specific. The first one that can be applied is used.")
+		line("[%s]", section.name)
+		for _, p := range packs {
+			if len(p.Description) > 0 {
+				line("# %s", p.Description)
+			}
+			for _, f := range section.formats(p) {
+				line("%s = %s", f.Name, f.Format)
+			}
+		}
+	}
+
+	return sb.String()
+}
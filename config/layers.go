@@ -0,0 +1,298 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The name of the configuration file in the home directory and in project directories.
+const configFileName = ".doglog"
+
+// The extensions tried for every configuration file in the search path, in order. The plain name is an INI file.
+var configExtensions = []string{"", ".yaml", ".yml", ".toml"}
+
+// The directive that pulls other configuration files into a file.
+const includeKey = "include"
+
+// The system-wide configuration file.
+var systemConfigFile = filepath.Join(string(filepath.Separator), "etc", "doglog", "config")
+
+// SearchPaths returns the configuration files that exist, from least-specific to most-specific: the system file,
+// the XDG config file, the file in the home directory, and the .doglog files found walking up from the current
+// directory (the closest one last). Each location may also hold a .yaml, .yml or .toml variant of the file.
+func SearchPaths() []string {
+	return append(existingPaths(userCandidates()), projectPaths()...)
+}
+
+// The project files: the .doglog files found walking up from the current directory, other than the user files, that
+// belong to the current user. They come with the repositories they're in, so they can't set the [server] keys and can
+// only include files of their own directory.
+func projectPaths() []string {
+	user := existingPaths(userCandidates())
+	var project []string
+	for _, path := range existingPaths(projectCandidates()) {
+		if !containsFile(user, path) && ownedByUser(path) {
+			project = append(project, path)
+		}
+	}
+	return project
+}
+
+// The configuration files of the system and the user, whether they exist or not.
+func userCandidates() []string {
+	candidates := []string{systemConfigFile}
+
+	home, _ := os.UserHomeDir()
+	xdgHome := os.Getenv("XDG_CONFIG_HOME")
+	if len(xdgHome) == 0 && len(home) > 0 {
+		xdgHome = filepath.Join(home, ".config")
+	}
+	if len(xdgHome) > 0 {
+		candidates = append(candidates, filepath.Join(xdgHome, "doglog", "config"))
+	}
+	if len(home) > 0 {
+		candidates = append(candidates, filepath.Join(home, configFileName))
+	}
+	return candidates
+}
+
+// The .doglog files of the current directory and its parents up to the repository root or the home directory, the
+// closest one last, whether they exist or not. Outside a repository and the home directory only the current directory
+// is used, so a file in a shared directory such as /tmp isn't picked up by everyone working below it.
+func projectCandidates() []string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
+	}
+	home, _ := os.UserHomeDir()
+	var candidates []string
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		candidates = append([]string{filepath.Join(dir, configFileName)}, candidates...)
+		if isRepositoryRoot(dir) || len(home) > 0 && sameDir(dir, home) {
+			return candidates
+		}
+		if filepath.Dir(dir) == dir {
+			return []string{filepath.Join(cwd, configFileName)}
+		}
+	}
+}
+
+// Check whether a directory is the root of a git repository.
+func isRepositoryRoot(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// Check whether two paths are the same directory.
+func sameDir(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// Keep the candidate files, or their .yaml, .yml or .toml variants, that exist. A file reached through two paths,
+// e.g. the home directory also found walking up from the current directory, is only kept once.
+func existingPaths(candidates []string) []string {
+	var paths []string
+	for _, candidate := range candidates {
+		for _, ext := range configExtensions {
+			path := candidate + ext
+			if info, err := os.Stat(path); err == nil && !info.IsDir() && !containsFile(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// Expand the configuration files into the full list of files to read, in order. The files pulled in with 'include'
+// come right before the file that includes them, so the including file can override them. The project files, and the
+// files they include, are returned separately too. A project file can't include files outside its directory, such
+// includes are skipped with a warning.
+func expandIncludes(configPaths []string) ([]string, []string, []string, error) {
+	projects := projectPaths()
+	var result []string
+	var project []string
+	var warnings []string
+	// The project directory is empty for the files of the system and the user
+	var visit func(path string, chain []string, projectDir string) error
+	visit = func(path string, chain []string, projectDir string) error {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("configuration file not found at %s - %s", path, err)
+		}
+		if containsPath(chain, path) {
+			return fmt.Errorf("configuration file %s includes itself (%s)", path, strings.Join(append(chain, path), " -> "))
+		}
+		if len(projectDir) == 0 && containsFile(projects, path) {
+			projectDir = filepath.Dir(path)
+		}
+		f, err := readConfig(path)
+		if err != nil {
+			return err
+		}
+		if value := f.Section(ini.DefaultSection).Key(includeKey).String(); len(value) > 0 {
+			for _, include := range splitList(value) {
+				if len(include) == 0 {
+					continue
+				}
+				included := resolveInclude(path, include)
+				if len(projectDir) > 0 && !insideDir(projectDir, included) {
+					warnings = append(warnings, fmt.Sprintf("%s: the include %s is outside the project directory %s, it is ignored", path, include, projectDir))
+					continue
+				}
+				if len(projectDir) > 0 && !ownedByUser(included) {
+					warnings = append(warnings, fmt.Sprintf("%s: the include %s belongs to another user, it is ignored", path, include))
+					continue
+				}
+				if err := visit(included, append(chain, path), projectDir); err != nil {
+					return err
+				}
+			}
+		}
+		if !containsPath(result, path) {
+			result = append(result, path)
+			if len(projectDir) > 0 {
+				project = append(project, path)
+			}
+		}
+		return nil
+	}
+
+	for _, path := range configPaths {
+		if err := visit(path, nil, ""); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return result, project, warnings, nil
+}
+
+// ProjectWarnings returns the [server] keys and the includes of the project files that were ignored.
+func (c *IniFile) ProjectWarnings() []string {
+	return c.projectWarnings
+}
+
+// Remove the [server] section of a project file: its key commands would run as soon as doglog is used in the
+// repository, and its site would receive the keys of the home directory. Returns a warning for every ignored key.
+func dropServerKeys(path string, f *ini.File) []string {
+	if !f.HasSection(serverSection) {
+		return nil
+	}
+	var warnings []string
+	for _, name := range f.Section(serverSection).KeyStrings() {
+		warnings = append(warnings, fmt.Sprintf("%s: [%s] %s is ignored, the keys and the site can only be set in ~/%s, the XDG or the system configuration file",
+			path, serverSection, name, configFileName))
+	}
+	f.DeleteSection(serverSection)
+	return warnings
+}
+
+// Check whether a file is in a directory or one of its subdirectories, once symbolic links are resolved.
+func insideDir(dir string, path string) bool {
+	dir, path = realPath(dir), realPath(path)
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Resolve the symbolic links of a path. A path that doesn't exist is only made absolute.
+func realPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		path = real
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// Resolve an included path: '~' is the home directory and relative paths are relative to the including file.
+func resolveInclude(from string, include string) string {
+	if strings.HasPrefix(include, "~/") || include == "~" {
+		if home, err := os.UserHomeDir(); err == nil {
+			include = filepath.Join(home, include[1:])
+		}
+	}
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(from), include)
+	}
+	return include
+}
+
+// Merge configuration files, later files overriding the keys of earlier ones. Keys added to a format section by a
+// later file are tried before the formats of the earlier files, so project formats win over the generic ones.
+func mergeConfigs(files []*ini.File) *ini.File {
+	merged := ini.Empty()
+	for _, f := range files {
+		for _, section := range f.Sections() {
+			target := merged.Section(section.Name())
+			var added []*ini.Key
+			for _, k := range section.Keys() {
+				if k.Name() == includeKey && section.Name() == ini.DefaultSection {
+					continue
+				}
+				// HasKey and Key also look in the parent sections, e.g. [formats.short] for [formats.short.checkout]
+				if contains(target.KeyStrings(), k.Name()) {
+					target.Key(k.Name()).SetValue(k.Value())
+				} else {
+					added = append(added, k)
+				}
+			}
+			if strings.HasPrefix(section.Name(), formatsSectionPrefix) {
+				prependKeys(target, added)
+			} else {
+				for _, k := range added {
+					_, _ = target.NewKey(k.Name(), k.Value())
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// Add keys to the front of a section, keeping the existing keys after them.
+func prependKeys(section *ini.Section, keys []*ini.Key) {
+	if len(keys) == 0 {
+		return
+	}
+	existing := section.Keys()
+	values := make([]string, len(existing))
+	for i, k := range existing {
+		values[i] = k.Value()
+	}
+	for _, k := range existing {
+		section.DeleteKey(k.Name())
+	}
+	for _, k := range keys {
+		_, _ = section.NewKey(k.Name(), k.Value())
+	}
+	for i, k := range existing {
+		_, _ = section.NewKey(k.Name(), values[i])
+	}
+}
+
+// Check whether a list of paths contains the file of a path, even when it's reached through another path.
+func containsFile(paths []string, path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return containsPath(paths, path)
+	}
+	for _, p := range paths {
+		if other, err := os.Stat(p); err == nil && os.SameFile(info, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a list of paths contains a path.
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"doglog/consts"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const levelsSection string = "levels"            // [levels]
+const levelColorsSection string = "level-colors" // [level-colors]
+
+// The key of the [levels] section that lists the canonical levels from least to most severe.
+const levelOrderKey = "order"
+
+// The canonical levels, from least to most severe.
+var defaultLevelOrder = []string{
+	consts.TraceLevel, consts.DebugLevel, consts.InfoLevel, consts.NoticeLevel,
+	consts.WarnLevel, consts.ErrorLevel, consts.CriticalLevel, consts.FatalLevel,
+}
+
+// The built-in level mappings: exact names, prefixes ending in '*' and numeric ranges. Numbers 0-7 are syslog
+// severities, 10-69 are bunyan/pino levels.
+var defaultLevelPatterns = map[string][]string{
+	consts.TraceLevel:    {"T*", "10-19"},
+	consts.DebugLevel:    {"D*", "V*", "7", "20-29"},
+	consts.InfoLevel:     {"I*", "6", "30-39"},
+	consts.NoticeLevel:   {"N*", "5"},
+	consts.WarnLevel:     {"W*", "4", "40-49"},
+	consts.ErrorLevel:    {"E*", "3", "50-59"},
+	consts.CriticalLevel: {"CRIT*", "2"},
+	consts.FatalLevel:    {"F*", "EMERG*", "ALERT", "PANIC", "0-1", "60-69"},
+}
+
+// The built-in level colors.
+var defaultLevelColors = map[string]string{
+	consts.TraceLevel:    consts.DebugEsc,
+	consts.DebugLevel:    consts.DebugEsc,
+	consts.InfoLevel:     consts.InfoEsc,
+	consts.NoticeLevel:   consts.CyanEsc,
+	consts.WarnLevel:     consts.WarnEsc,
+	consts.ErrorLevel:    consts.ErrorEsc,
+	consts.CriticalLevel: consts.ErrorEsc,
+	consts.FatalLevel:    consts.ErrorEsc,
+}
+
+// The color names that can be used in the [level-colors] section.
+var colorNames = map[string]string{
+	"grey":    consts.GreyEsc,
+	"gray":    consts.GreyEsc,
+	"red":     consts.RedEsc,
+	"green":   consts.GreenEsc,
+	"yellow":  consts.YellowEsc,
+	"blue":    consts.BlueEsc,
+	"magenta": consts.MagentaEsc,
+	"cyan":    consts.CyanEsc,
+	"white":   consts.WhiteEsc,
+	"none":    "",
+}
+
+// A single rule mapping raw levels to a canonical level.
+type levelPattern struct {
+	level string
+	// Exactly one of these is set
+	exact  string
+	prefix string
+	min    float64
+	max    float64
+	ranged bool
+}
+
+// Levels maps the levels found in log messages to a canonical, ordered set of levels with colors.
+type Levels struct {
+	order    []string
+	patterns []levelPattern
+	colors   map[string]string
+}
+
+// Levels gets the level mappings from the config file, merged with the built-in ones. The [levels] section maps each
+// canonical level to a list of exact names, prefixes (e.g. WARN*) and numeric ranges (e.g. 40-49), and may list the
+// canonical levels from least to most severe in 'order'. The [level-colors] section sets the color of each level.
+func (c *IniFile) Levels() *Levels {
+	if c.storedLevels != nil {
+		return c.storedLevels
+	}
+
+	levels := &Levels{colors: make(map[string]string)}
+	section := c.ini.Section(levelsSection)
+
+	levels.order = append(levels.order, defaultLevelOrder...)
+	if order := section.Key(levelOrderKey).String(); len(order) > 0 {
+		levels.order = nil
+		for _, name := range splitList(order) {
+			levels.order = append(levels.order, strings.ToUpper(name))
+		}
+	}
+
+	// The configured patterns are tried before the built-in ones
+	var configured []levelPattern
+	for _, k := range section.Keys() {
+		if k.Name() == levelOrderKey {
+			continue
+		}
+		name := strings.ToUpper(k.Name())
+		if !contains(levels.order, name) {
+			levels.order = append(levels.order, name)
+		}
+		for _, p := range splitList(k.Value()) {
+			if pattern, ok := parseLevelPattern(name, p); ok {
+				configured = append(configured, pattern)
+			}
+		}
+	}
+	var builtIn []levelPattern
+	for _, name := range defaultLevelOrder {
+		for _, p := range defaultLevelPatterns[name] {
+			if pattern, ok := parseLevelPattern(name, p); ok {
+				builtIn = append(builtIn, pattern)
+			}
+		}
+	}
+	levels.patterns = append(sortLevelPatterns(configured), sortLevelPatterns(builtIn)...)
+
+	for name, color := range defaultLevelColors {
+		levels.colors[name] = color
+	}
+	for _, k := range c.ini.Section(levelColorsSection).Keys() {
+		if color, ok := colorNames[strings.ToLower(k.Value())]; ok {
+			levels.colors[strings.ToUpper(k.Name())] = color
+		}
+	}
+
+	c.storedLevels = levels
+	return levels
+}
+
+// Parse a level pattern: an exact name, a prefix ending in '*', a number or a numeric range such as 40-49.
+func parseLevelPattern(level string, pattern string) (levelPattern, bool) {
+	pattern = strings.ToUpper(strings.TrimSpace(pattern))
+	if len(pattern) == 0 {
+		return levelPattern{}, false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return levelPattern{level: level, prefix: prefix}, true
+	}
+	if n, err := strconv.ParseFloat(pattern, 64); err == nil {
+		return levelPattern{level: level, min: n, max: n, ranged: true}, true
+	}
+	if from, to, ok := strings.Cut(pattern, "-"); ok {
+		min, err1 := strconv.ParseFloat(strings.TrimSpace(from), 64)
+		max, err2 := strconv.ParseFloat(strings.TrimSpace(to), 64)
+		if err1 == nil && err2 == nil {
+			return levelPattern{level: level, min: min, max: max, ranged: true}, true
+		}
+	}
+	return levelPattern{level: level, exact: pattern}, true
+}
+
+// Order patterns so exact names are tried first, then numeric ranges, then prefixes from longest to shortest. This
+// way 'EMERG*' wins over 'E*' regardless of the order the patterns were written in.
+func sortLevelPatterns(patterns []levelPattern) []levelPattern {
+	rank := func(p levelPattern) int {
+		switch {
+		case len(p.exact) > 0:
+			return 0
+		case p.ranged:
+			return 1
+		}
+		return 2
+	}
+	sort.SliceStable(patterns, func(i, j int) bool {
+		if rank(patterns[i]) != rank(patterns[j]) {
+			return rank(patterns[i]) < rank(patterns[j])
+		}
+		return len(patterns[i].prefix) > len(patterns[j].prefix)
+	})
+	return patterns
+}
+
+// Normalize maps a raw level, e.g. 'warning', 'CRIT' or '30', to its canonical level. Levels that don't match any
+// rule are returned uppercased.
+func (l *Levels) Normalize(raw string) string {
+	level := strings.ToUpper(strings.TrimSpace(raw))
+	if len(level) == 0 {
+		return level
+	}
+	number, err := strconv.ParseFloat(level, 64)
+	isNumber := err == nil
+	for _, p := range l.patterns {
+		switch {
+		case len(p.exact) > 0:
+			if p.exact == level {
+				return p.level
+			}
+		case p.ranged:
+			if isNumber && number >= p.min && number <= p.max {
+				return p.level
+			}
+		default:
+			if !isNumber && strings.HasPrefix(level, p.prefix) {
+				return p.level
+			}
+		}
+	}
+	return level
+}
+
+// Severity returns the position of a canonical level in the order from least to most severe.
+func (l *Levels) Severity(level string) (int, bool) {
+	for i, name := range l.order {
+		if name == level {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Names returns the canonical levels from least to most severe.
+func (l *Levels) Names() []string {
+	return l.order
+}
+
+// Color returns the color escape used to display a canonical level, or an empty string.
+func (l *Levels) Color(level string) string {
+	return l.colors[level]
+}
@@ -0,0 +1,18 @@
+package config
+
+// The section of the time markers used with --start and --end, e.g. 'deploy = 2024-07-11 15:00'.
+const markersSection = "markers"
+
+// Marker gets a time saved in the [markers] section by name.
+func (c *IniFile) Marker(name string) (string, bool) {
+	section := c.ini.Section(markersSection)
+	if !contains(section.KeyStrings(), name) {
+		return "", false
+	}
+	return section.Key(name).String(), true
+}
+
+// MarkerNames gets the names of the time markers of the [markers] section.
+func (c *IniFile) MarkerNames() []string {
+	return c.ini.Section(markersSection).KeyStrings()
+}
@@ -0,0 +1,6 @@
+package config
+
+// File owners aren't checked on Windows, like the file modes.
+func ownedByUser(path string) bool {
+	return true
+}
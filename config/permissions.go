@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// The server key that turns the permission warning into an error.
+const strictPermissionsKey = "strict-permissions"
+
+// Check whether a configuration file holds a plaintext api or application key.
+func hasKeys(f *ini.File) bool {
+	server := f.Section(serverSection)
+	for _, name := range SecretNames() {
+		if value := server.Key(name).String(); len(value) > 0 && value != placeholderValue {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the configuration files that hold keys and can be read by other users.
+func insecureFiles(paths []string, files []*ini.File) []string {
+	var insecure []string
+	for i, path := range paths {
+		if hasKeys(files[i]) && readableByOthers(path) {
+			insecure = append(insecure, path)
+		}
+	}
+	return insecure
+}
+
+// Check whether a file can be read by other users. File modes aren't checked on Windows.
+func readableByOthers(path string) bool {
+	if runtime.GOOS == "windows" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().Perm()&0077 != 0
+}
+
+// InsecurePaths returns the configuration files that hold api or application keys and can be read by other users.
+func (c *IniFile) InsecurePaths() []string {
+	return c.insecurePaths
+}
+
+// StrictPermissions reports whether the keys must not be read from files that other users can read.
+func (c *IniFile) StrictPermissions() bool {
+	return c.ini.Section(serverSection).Key(strictPermissionsKey).MustBool(false)
+}
+
+// CheckPermissions warns about the configuration files that hold keys and can be read by other users. With
+// strict-permissions set, an error is returned instead.
+func (c *IniFile) CheckPermissions(out io.Writer) error {
+	if len(c.insecurePaths) > 0 {
+		message := permissionMessage(c.insecurePaths)
+		if c.StrictPermissions() {
+			return fmt.Errorf("refusing to use the keys - %s", message)
+		}
+		_, _ = fmt.Fprintf(out, "Warning: %s\n", message)
+	}
+	return CheckKeyFile(c.SecretsKeyFile(), c.StrictPermissions(), out)
+}
+
+// CheckKeyFile warns when the key file that unlocks the secrets file can be read by other users. With strict set, an
+// error is returned instead.
+func CheckKeyFile(path string, strict bool, out io.Writer) error {
+	if len(path) == 0 || !readableByOthers(path) {
+		return nil
+	}
+	message := keyFileMessage(path)
+	if strict {
+		return fmt.Errorf("refusing to use the key file - %s", message)
+	}
+	_, _ = fmt.Fprintf(out, "Warning: %s\n", message)
+	return nil
+}
+
+// Describe a key file that can be read by other users and how to fix it.
+func keyFileMessage(path string) string {
+	mode := ""
+	if info, err := os.Stat(path); err == nil {
+		mode = fmt.Sprintf(" (mode %04o)", info.Mode().Perm())
+	}
+	return fmt.Sprintf("the secrets key file %s%s can be read by other users, who can unlock the secrets file with it, run 'chmod 600 %s'",
+		path, mode, path)
+}
+
+// Describe the files that can be read by other users and how to fix them.
+func permissionMessage(paths []string) string {
+	var modes []string
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			modes = append(modes, fmt.Sprintf("%s (mode %04o)", path, info.Mode().Perm()))
+		}
+	}
+	return fmt.Sprintf("the Datadog keys in %s can be read by other users, run 'chmod 600 %s' or move the keys to a secrets file with 'doglog secrets set'",
+		strings.Join(modes, ", "), strings.Join(paths, " "))
+}
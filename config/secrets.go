@@ -0,0 +1,259 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The server keys that set up the encrypted secrets file.
+const secretsFileKey = "secrets-file"
+const secretsKeyFileKey = "secrets-key-file"
+
+// The name of the encrypted secrets file in the home directory.
+const secretsFileName = ".doglog.secrets"
+
+// The environment variables that unlock the secrets file without a prompt.
+const passphraseVariable = "DOGLOG_PASSPHRASE"
+const keyFileVariable = "DOGLOG_SECRETS_KEY_FILE"
+
+// The version of the secrets file format.
+const secretsVersion = 1
+
+// The scrypt parameters used to derive the encryption key from the passphrase.
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltLen      = 16
+)
+
+// The layout of the secrets file. The data is the AES-GCM encrypted JSON object of the secrets, by key name.
+type secretsFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// SecretNames returns the names of the keys that can be stored in the secrets file.
+func SecretNames() []string {
+	return []string{apiKey, applicationKey}
+}
+
+// DefaultSecretsFile returns the location of the secrets file in the home directory.
+func DefaultSecretsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, secretsFileName)
+}
+
+// SecretsFile returns the location of the encrypted secrets file: the secrets-file of the server section, or the
+// file in the home directory when it exists. Returns an empty string when there is no secrets file.
+func (c *IniFile) SecretsFile() string {
+	if path := c.ini.Section(serverSection).Key(secretsFileKey).MustString(""); len(path) > 0 {
+		return expandHome(path)
+	}
+	if path := DefaultSecretsFile(); len(path) > 0 {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// SecretsKeyFile returns the key file that unlocks the secrets file instead of a passphrase, if any.
+func (c *IniFile) SecretsKeyFile() string {
+	if path := os.Getenv(keyFileVariable); len(path) > 0 {
+		return expandHome(path)
+	}
+	return expandHome(c.ini.Section(serverSection).Key(secretsKeyFileKey).MustString(""))
+}
+
+// Get a key from the encrypted secrets file. The file is only unlocked once.
+func (c *IniFile) secret(name string) (string, bool) {
+	if c.storedSecrets == nil {
+		c.storedSecrets = make(map[string]string)
+		path := c.SecretsFile()
+		if len(path) == 0 {
+			return "", false
+		}
+		passphrase, err := SecretsPassphrase(path, c.SecretsKeyFile(), false)
+		if err == nil {
+			c.storedSecrets, err = ReadSecrets(path, passphrase)
+		}
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Can't read the secrets file %s - %s\n", path, err)
+			c.storedSecrets = make(map[string]string)
+		}
+	}
+	value, ok := c.storedSecrets[name]
+	return value, ok && len(value) > 0
+}
+
+// SecretsPassphrase gets the passphrase that unlocks a secrets file: the contents of the key file, the
+// DOGLOG_PASSPHRASE environment variable, or a prompt on the terminal. When confirm is set, the passphrase for a new
+// file is asked twice.
+func SecretsPassphrase(path string, keyFile string, confirm bool) ([]byte, error) {
+	if len(keyFile) > 0 {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the key file - %s", err)
+		}
+		key = []byte(strings.TrimSpace(string(key)))
+		if len(key) == 0 {
+			return nil, fmt.Errorf("the key file %s is empty", keyFile)
+		}
+		return key, nil
+	}
+	if passphrase := os.Getenv(passphraseVariable); len(passphrase) > 0 {
+		return []byte(passphrase), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("no passphrase, set %s or use a key file", passphraseVariable)
+	}
+
+	passphrase, err := readPassphrase(fmt.Sprintf("Passphrase for %s: ", path))
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := readPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(passphrase) {
+			return nil, fmt.Errorf("the passphrases don't match")
+		}
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("the passphrase is empty")
+	}
+	return passphrase, nil
+}
+
+// Read a passphrase from the terminal without echoing it.
+func readPassphrase(prompt string) ([]byte, error) {
+	_, _ = fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	_, _ = fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// ReadSecrets decrypts a secrets file.
+func ReadSecrets(path string, passphrase []byte) (map[string]string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f secretsFile
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, fmt.Errorf("not a secrets file - %s", err)
+	}
+	if f.Version != secretsVersion {
+		return nil, fmt.Errorf("unsupported secrets file version %d", f.Version)
+	}
+	aead, err := secretsCipher(passphrase, f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	data, err := aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or key file")
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("the secrets are corrupt - %s", err)
+	}
+	return secrets, nil
+}
+
+// WriteSecrets encrypts the secrets into a file that only the user can read. A new salt and nonce are used every
+// time the file is written.
+func WriteSecrets(path string, passphrase []byte, secrets map[string]string) error {
+	f := secretsFile{Version: secretsVersion, Salt: make([]byte, saltLen)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := secretsCipher(passphrase, f.Salt)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	f.Data = aead.Seal(nil, f.Nonce, data, nil)
+
+	buf, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(buf, '\n'), 0600)
+}
+
+// Write a file through a temporary file in the same directory that replaces it once complete, so a crash can't leave
+// the file truncated.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := tmp.Chmod(mode); err != nil && runtime.GOOS != "windows" {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Derive the encryption key from the passphrase and set up the cipher.
+func secretsCipher(passphrase []byte, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Expand a leading '~' to the home directory.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/ini.v1"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The extensions of TOML configuration files.
+var tomlExtensions = []string{".toml"}
+
+// Check whether a configuration file is in TOML format.
+func isTomlFile(path string) bool {
+	return contains(tomlExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// Read a TOML configuration file. The TOML file has the same sections (tables) as the INI file, e.g.
+// [formats.short], with arrays becoming comma-separated values and top-level keys going into the default section.
+func readTomlConfig(configPath string) (*ini.File, error) {
+	var data map[string]interface{}
+	md, err := toml.DecodeFile(configPath, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := ini.Empty()
+	for _, key := range md.Keys() {
+		if md.Type(key...) == "Hash" || len(key) == 0 {
+			continue
+		}
+		value, ok := tomlLookup(data, key)
+		if !ok {
+			// Keys inside arrays of tables
+			continue
+		}
+		section := ini.DefaultSection
+		if len(key) > 1 {
+			section = strings.Join(key[:len(key)-1], ".")
+		}
+		_, _ = cfg.Section(section).NewKey(key[len(key)-1], tomlValue(value))
+	}
+	return cfg, nil
+}
+
+// Find the value of a TOML key.
+func tomlLookup(data map[string]interface{}, key toml.Key) (interface{}, bool) {
+	var current interface{} = data
+	for _, part := range key {
+		table, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = table[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// Convert a TOML value into a configuration value.
+func tomlValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = tomlValue(v[i])
+		}
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Add the positions of the table headers and keys of a TOML configuration file. The TOML reader doesn't report where
+// keys are defined, so the file is scanned line by line: headers, 'key = value' lines (dotted keys name sub-tables)
+// and multi-line strings, whose lines are skipped.
+func tomlPositions(path string, positions map[string]position) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	section := ini.DefaultSection
+	closing := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if len(closing) > 0 {
+			// Inside a multi-line string
+			if strings.Contains(text, closing) {
+				closing = ""
+			}
+			continue
+		}
+		trimmed := strings.TrimSpace(text)
+		indent := len(text) - len(strings.TrimLeft(text, " \t"))
+		switch {
+		case len(trimmed) == 0 || strings.HasPrefix(trimmed, "#"):
+		case strings.HasPrefix(trimmed, "["):
+			name := strings.Trim(strings.SplitN(trimmed, "#", 2)[0], " \t[]")
+			section = strings.Join(tomlKeyParts(name), ".")
+			if _, ok := positions[section+"\x00"]; !ok {
+				positions[section+"\x00"] = position{file: path, line: line, column: indent + 1}
+			}
+		default:
+			i := strings.Index(text, "=")
+			if i < 0 {
+				continue
+			}
+			parts := tomlKeyParts(text[:i])
+			if len(parts) == 0 {
+				continue
+			}
+			keySection := section
+			if len(parts) > 1 {
+				keySection = strings.Join(append(nonDefault(section), parts[:len(parts)-1]...), ".")
+			}
+			valueStart := i + 1
+			for valueStart < len(text) && (text[valueStart] == ' ' || text[valueStart] == '\t') {
+				valueStart++
+			}
+			value := strings.TrimSpace(text[valueStart:])
+			valueLine, column := line, valueStart+1
+			for _, quotes := range []string{`"""`, "'''"} {
+				if rest, ok := strings.CutPrefix(value, quotes); ok {
+					if !strings.Contains(rest, quotes) {
+						closing = quotes
+					}
+					if len(rest) == 0 {
+						// The newline right after the quotes isn't part of the string
+						valueLine, column = line+1, 1
+					} else {
+						column += len(quotes)
+					}
+					value = rest
+					break
+				}
+			}
+			if len(closing) == 0 && (strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'")) {
+				column++
+			}
+			positions[keySection+"\x00"+parts[len(parts)-1]] = position{file: path, line: valueLine, column: column, value: value}
+		}
+	}
+}
+
+// Split a TOML key or table name into its dotted parts, removing the quotes of quoted parts.
+func tomlKeyParts(key string) []string {
+	var parts []string
+	var current strings.Builder
+	quote := byte(0)
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.':
+			parts = append(parts, strings.TrimSpace(current.String()))
+			current.Reset()
+		case c != ' ' && c != '\t':
+			current.WriteByte(c)
+		}
+	}
+	if last := strings.TrimSpace(current.String()); len(last) > 0 || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// The parts of a section name, none for the default section.
+func nonDefault(section string) []string {
+	if section == ini.DefaultSection {
+		return nil
+	}
+	return []string{section}
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The extensions of YAML configuration files.
+var yamlExtensions = []string{".yaml", ".yml"}
+
+// Check whether a configuration file is in YAML format.
+func isYamlFile(path string) bool {
+	return contains(yamlExtensions, strings.ToLower(filepath.Ext(path)))
+}
+
+// Read a YAML configuration file. The YAML file has the same sections as the INI file, with nested mappings naming
+// the dotted sections, e.g.:
+//
+//	server:
+//	  api-key: ...
+//	formats:
+//	  short:
+//	    java1: "{{.__timestamp}} ..."
+//
+// Lists become comma-separated values and top-level values (e.g. include) go into the default section.
+func readYamlConfig(configPath string) (*ini.File, error) {
+	buf, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, err
+	}
+
+	cfg := ini.Empty()
+	if len(doc.Content) == 0 {
+		return cfg, nil
+	}
+	var walkErr error
+	walkYaml(doc.Content[0], ini.DefaultSection, func(section string, key string, node *yaml.Node) {
+		value, err := yamlValue(node)
+		if err != nil && walkErr == nil {
+			walkErr = fmt.Errorf("line %d: %s", node.Line, err)
+		}
+		_, _ = cfg.Section(section).NewKey(key, value)
+	})
+	return cfg, walkErr
+}
+
+// Walk a YAML mapping, calling visit for every value that isn't itself a mapping.
+func walkYaml(node *yaml.Node, section string, visit func(section string, key string, value *yaml.Node)) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if value.Kind == yaml.MappingNode {
+			child := key.Value
+			if section != ini.DefaultSection {
+				child = section + "." + key.Value
+			}
+			walkYaml(value, child, visit)
+		} else {
+			visit(section, key.Value, value)
+		}
+	}
+}
+
+// Convert a YAML scalar or list into a configuration value.
+func yamlValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, n := range node.Content {
+			if n.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("lists may only contain plain values")
+			}
+			values = append(values, n.Value)
+		}
+		return strings.Join(values, ", "), nil
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	}
+	return "", fmt.Errorf("unsupported value")
+}
+
+// Add the positions of the keys of a YAML configuration file.
+func yamlPositions(path string, positions map[string]position) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal(buf, &doc) != nil || len(doc.Content) == 0 {
+		return
+	}
+	walkYaml(doc.Content[0], ini.DefaultSection, func(section string, key string, node *yaml.Node) {
+		if _, ok := positions[section+"\x00"]; !ok {
+			positions[section+"\x00"] = position{file: path, line: node.Line, column: 1}
+		}
+		column := node.Column
+		switch node.Style {
+		case yaml.LiteralStyle, yaml.FoldedStyle:
+			// Block scalars start on the line after the indicator
+			column = 1
+		case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+			column++
+		}
+		positions[section+"\x00"+key] = position{file: path, line: node.Line, column: column, value: node.Value}
+	})
+}
@@ -22,6 +22,8 @@ const (
 	ComputedClassNameField      = "__classname"
 	ComputedThreadNameField     = "__threadname"
 	ComputedTimestampField      = "__timestamp"
+	ComputedTypedField          = "__typed"
+	ComputedUrlField            = "__url"
 
 	// Escape codes
 
@@ -52,10 +54,12 @@ const (
 	InfoEsc  = GreenEsc
 	WarnEsc  = YellowEsc
 
-	DebugLevel = "DEBUG"
-	ErrorLevel = "ERROR"
-	FatalLevel = "FATAL"
-	InfoLevel  = "INFO"
-	TraceLevel = "TRACE"
-	WarnLevel  = "WARN"
+	CriticalLevel = "CRITICAL"
+	DebugLevel    = "DEBUG"
+	ErrorLevel    = "ERROR"
+	FatalLevel    = "FATAL"
+	InfoLevel     = "INFO"
+	NoticeLevel   = "NOTICE"
+	TraceLevel    = "TRACE"
+	WarnLevel     = "WARN"
 )
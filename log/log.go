@@ -9,7 +9,7 @@ import (
 // debug/verbose output.
 func Debug(opts options.Options, msg string, a ...any) {
 	if opts.PrintDebug {
-		value := fmt.Sprintf(msg, a)
+		value := fmt.Sprintf(msg, a...)
 		fmt.Printf(">>> [DEBUG] %s\n", value)
 	}
 }
@@ -18,7 +18,7 @@ func Debug(opts options.Options, msg string, a ...any) {
 // debug/verbose output.
 func Info(opts options.Options, msg string, a ...any) {
 	if opts.PrintDebug {
-		value := fmt.Sprintf(msg, a)
+		value := fmt.Sprintf(msg, a...)
 		fmt.Printf(">>> [INFO] %s\n", value)
 	}
 }
@@ -27,7 +27,7 @@ func Info(opts options.Options, msg string, a ...any) {
 // debug/verbose output.
 func Error(opts options.Options, msg string, a ...any) {
 	if opts.PrintDebug {
-		value := fmt.Sprintf(msg, a)
+		value := fmt.Sprintf(msg, a...)
 		fmt.Printf(">>> [ERROR] %s\n", value)
 	}
 }
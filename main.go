@@ -3,11 +3,10 @@ package main
 import (
 	"doglog/cli"
 	"fmt"
-	"github.com/briandowns/spinner"
+	"golang.org/x/term"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
 // The appVersion is filled in during the build
@@ -18,16 +17,6 @@ var appVersion = "v0.0.0"
 // The gitHash is filled in during the build
 var gitHash = ""
 
-// Create a new terminal spinner.
-func setupSpinner() *spinner.Spinner {
-	s := spinner.New(spinner.CharSets[9], 100*time.Millisecond)
-	s.UpdateCharSet(spinner.CharSets[21]) // box of dots
-	s.Writer = os.Stderr
-	s.HideCursor = true
-	_ = s.Color("red", "bold")
-	return s
-}
-
 // This channel is purely for the handling of signals.
 func makeSignalsChannel() chan os.Signal {
 	c := make(chan os.Signal, 1)
@@ -37,37 +26,106 @@ func makeSignalsChannel() chan os.Signal {
 		syscall.SIGINT,  // Ctrl+C
 		syscall.SIGQUIT, // Ctrl-\
 		syscall.SIGKILL, // "always fatal", "SIGKILL and SIGSTOP may not be caught by a program"
-		syscall.SIGHUP,  // "terminal is disconnected"
 	)
+	if hangupExits() {
+		signal.Notify(c, syscall.SIGHUP) // The terminal was closed
+	}
+	return c
+}
+
+// This channel receives the requests to reload the configuration while tailing.
+func makeReloadChannel() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	if !hangupExits() {
+		signal.Notify(c, syscall.SIGHUP)
+	}
 	return c
 }
 
+// SIGHUP means the terminal was closed when running in a terminal, and is a request to reload the configuration
+// otherwise, e.g. for a tail started with nohup or by a service manager.
+func hangupExits() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func main() {
 	version := fmt.Sprintf("%v (%v)", appVersion, gitHash)
 	opts := cli.ParseArgs(version)
 
+	if opts.Command != cli.IndexesCommand && opts.Command != cli.ServicesCommand && len(opts.Input) == 0 {
+		if err := cli.CheckIndexes(opts); err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "Invalid -i/--indices - %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	switch opts.Command {
+	case cli.IndexesCommand:
+		os.Exit(cli.CommandIndexes(opts))
+	case cli.ServicesCommand:
+		os.Exit(cli.CommandServices(opts))
+	case cli.OpenCommand:
+		os.Exit(cli.CommandOpen(opts))
+	case cli.AggregateCommand:
+		os.Exit(cli.CommandAggregate(opts))
+	case cli.FieldsCommand:
+		os.Exit(cli.CommandFields(opts))
+	case cli.GetCommand:
+		os.Exit(cli.CommandGet(opts))
+	case cli.FormatsCommand:
+		os.Exit(cli.CommandFormatsTest(opts))
+	}
+
+	if opts.PrintUrl {
+		if link, err := cli.SearchUrl(opts); err == nil {
+			_, _ = fmt.Fprintln(os.Stderr, link)
+		}
+	}
+
 	if opts.DoTail {
 		var delay = cli.MinDelay
 
-		s := setupSpinner()
+		s := cli.NewStatusLine()
 		s.Start()
 
 		exitChan := makeSignalsChannel()
+		reloadChan := makeReloadChannel()
+		watcher := cli.NewConfigWatcher(opts)
 
 		// Handle exit signals - only needed when tailing
 		go func() {
 			for range exitChan {
 				s.Stop()
+				cli.ClosePipe()
+				cli.PrintSummary(opts)
 				os.Exit(0)
 			}
 		}()
 
+		// Reload the configuration on SIGHUP - the files are also watched for changes
+		go func() {
+			for range reloadChan {
+				watcher.Reload()
+			}
+		}()
+
 		//noinspection GoInfiniteFor
 		for {
+			watcher.Apply(opts, s)
 			found := cli.CommandListMessages(opts, s)
+			s.SetDelay(delay)
 			delay = cli.DelayForSeconds(delay, found)
 		}
+	} else if opts.Histogram {
+		if !cli.CommandHistogram(opts) {
+			os.Exit(1)
+		}
 	} else {
-		_ = cli.CommandListMessages(opts, nil)
+		ok := cli.CommandListMessages(opts, nil)
+		cli.ClosePipe()
+		cli.PrintSummary(opts)
+		if !ok {
+			os.Exit(1)
+		}
 	}
 }
@@ -4,6 +4,7 @@ import "doglog/config"
 
 // Options Structure stores the command-line options and values.
 type Options struct {
+	Command      string
 	Service      string
 	Query        string
 	Limit        int
@@ -19,4 +20,26 @@ type Options struct {
 	Indexes      []string
 	UseLong      bool
 	Version      bool
+	Histogram    bool
+	Summary      bool
+	OnMatch      []string
+	Exec         []string
+	Cooldowns    []int
+	Pipe         string
+	PipeOutput   bool
+	MinLevel     string
+	GroupBy      []string
+	Compute      []string
+	LogId        string
+	Input        string
+	Refresh      bool
+	PrintUrl     bool
+	Hosts        []string
+	Envs         []string
+	Statuses     []string
+	Tags         []string
+	Attrs        []string
+	AttrsNot     []string
+	AttrRanges   []string
+	Timezone     string
 }
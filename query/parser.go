@@ -0,0 +1,367 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The name of a tag or an @attribute.
+var fieldName = regexp.MustCompile(`^@?[A-Za-z0-9_][A-Za-z0-9_.\-@/]*$`)
+
+// The boolean operators. They are only operators in capitals; 'and' is a search term.
+const (
+	andOperator = "AND"
+	orOperator  = "OR"
+	notOperator = "NOT"
+)
+
+// A recursive descent parser of the Datadog log search syntax.
+type parser struct {
+	text   string
+	offset int
+}
+
+// Parse Parse a query in the Datadog log search syntax. An empty query, which matches every message, returns a nil
+// node.
+func Parse(text string) (Node, error) {
+	p := &parser{text: text}
+	p.skipSpaces()
+	if p.done() {
+		return nil, nil
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if !p.done() {
+		if p.peek() == ')' {
+			return nil, p.errorAt(p.offset, "unexpected ')' without a matching '('")
+		}
+		return nil, p.errorAt(p.offset, "unexpected text")
+	}
+	return node, nil
+}
+
+// Build an error at an offset of the query.
+func (p *parser) errorAt(offset int, message string) error {
+	return &Error{Query: p.text, Offset: offset, Message: message}
+}
+
+// Check whether the whole query was read.
+func (p *parser) done() bool {
+	return p.offset >= len(p.text)
+}
+
+// The next character, or 0 at the end of the query.
+func (p *parser) peek() rune {
+	if p.done() {
+		return 0
+	}
+	r, _ := utf8.DecodeRuneInString(p.text[p.offset:])
+	return r
+}
+
+// Move past the next character.
+func (p *parser) next() rune {
+	r, size := utf8.DecodeRuneInString(p.text[p.offset:])
+	p.offset += size
+	return r
+}
+
+// Move past the spaces.
+func (p *parser) skipSpaces() {
+	for !p.done() && unicode.IsSpace(p.peek()) {
+		p.next()
+	}
+}
+
+// Check whether an operator comes next, as a word of its own.
+func (p *parser) peekOperator(operator string) bool {
+	if !strings.HasPrefix(p.text[p.offset:], operator) {
+		return false
+	}
+	end := p.offset + len(operator)
+	if end == len(p.text) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(p.text[end:])
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// or := and ('OR' and)*
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for {
+		p.skipSpaces()
+		if !p.peekOperator(orOperator) {
+			break
+		}
+		operator := p.offset
+		p.offset += len(orOperator)
+		p.skipSpaces()
+		if p.done() || p.peek() == ')' {
+			return nil, p.errorAt(operator, "'OR' needs a term after it")
+		}
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return flatten(&Or{}, nodes), nil
+}
+
+// and := unary (['AND'] unary)*
+func (p *parser) parseAnd() (Node, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{first}
+	for {
+		p.skipSpaces()
+		if p.done() || p.peek() == ')' || p.peekOperator(orOperator) {
+			break
+		}
+		if p.peekOperator(andOperator) {
+			operator := p.offset
+			p.offset += len(andOperator)
+			p.skipSpaces()
+			if p.done() || p.peek() == ')' || p.peekOperator(orOperator) {
+				return nil, p.errorAt(operator, "'AND' needs a term after it")
+			}
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return flatten(&And{}, nodes), nil
+}
+
+// unary := ('-' | '!' | 'NOT') unary | primary
+func (p *parser) parseUnary() (Node, error) {
+	p.skipSpaces()
+	start := p.offset
+	switch {
+	case p.peekOperator(notOperator):
+		p.offset += len(notOperator)
+		p.skipSpaces()
+		if p.done() || p.peek() == ')' {
+			return nil, p.errorAt(start, "'NOT' needs a term after it")
+		}
+	case p.peek() == '-' || p.peek() == '!':
+		p.next()
+		if p.done() || unicode.IsSpace(p.peek()) || p.peek() == ')' {
+			return nil, p.errorAt(start, "'"+p.text[start:p.offset]+"' needs a term right after it")
+		}
+	default:
+		return p.parsePrimary()
+	}
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &Not{Node: node}, nil
+}
+
+// primary := '(' or ')' | term
+func (p *parser) parsePrimary() (Node, error) {
+	p.skipSpaces()
+	start := p.offset
+	switch {
+	case p.done():
+		return nil, p.errorAt(start, "missing term")
+	case p.peek() == ')':
+		return nil, p.errorAt(start, "unexpected ')' without a matching '('")
+	case p.peekOperator(andOperator) || p.peekOperator(orOperator):
+		return nil, p.errorAt(start, "'"+strings.Fields(p.text[start:])[0]+"' needs a term before it")
+	case p.peek() == '(':
+		return p.parseGroup()
+	}
+	return p.parseTerm()
+}
+
+// Parse the nodes between parentheses.
+func (p *parser) parseGroup() (Node, error) {
+	open := p.offset
+	p.next()
+	p.skipSpaces()
+	if p.peek() == ')' {
+		return nil, p.errorAt(open, "empty parentheses")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.peek() != ')' {
+		return nil, p.errorAt(open, "missing ')' to close this '('")
+	}
+	p.next()
+	return node, nil
+}
+
+// term := [field ':'] value | phrase
+func (p *parser) parseTerm() (Node, error) {
+	start := p.offset
+	if p.peek() == '"' {
+		phrase, err := p.parsePhrase()
+		if err != nil {
+			return nil, err
+		}
+		return &Term{Value: phrase, Offset: start}, nil
+	}
+
+	word, err := p.parseWord(true)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != ':' {
+		return &Term{Value: word, Offset: start}, nil
+	}
+	if !fieldName.MatchString(word) {
+		return nil, p.errorAt(start, "invalid attribute or tag name '"+word+"'")
+	}
+	p.next()
+	term := &Term{Field: word, Offset: start}
+	valueStart := p.offset
+
+	switch r := p.peek(); {
+	case p.done() || unicode.IsSpace(r) || r == ')':
+		return nil, p.errorAt(valueStart, "missing value after '"+word+":'")
+	case r == '"':
+		term.Value, err = p.parsePhrase()
+	case r == '[' || r == '{':
+		term.Value, err = p.parseRange()
+	case r == '>' || r == '<':
+		term.Value, err = p.parseComparison()
+	case r == '(':
+		term.Group, err = p.parseGroup()
+	default:
+		term.Value, err = p.parseWord(false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+// Parse a word, keeping its escapes. Wildcards are part of the word. The first colon of a term ends the word, so it
+// can be a field name; later colons are part of the value.
+func (p *parser) parseWord(stopAtColon bool) (string, error) {
+	start := p.offset
+	for !p.done() {
+		r := p.peek()
+		if unicode.IsSpace(r) || r == '(' || r == ')' || (stopAtColon && r == ':') {
+			break
+		}
+		if r == '"' {
+			return "", p.errorAt(p.offset, "unexpected '\"' inside a term, escape it with '\\'")
+		}
+		p.next()
+		if r == '\\' {
+			if p.done() {
+				return "", p.errorAt(p.offset-1, "'\\' at the end of the query escapes nothing")
+			}
+			p.next()
+		}
+	}
+	if p.offset == start {
+		return "", p.errorAt(start, "missing term")
+	}
+	return p.text[start:p.offset], nil
+}
+
+// Parse a phrase between double quotes, keeping the quotes and escapes. The phrase must end the term, so a space, a
+// ')' or the end of the query has to follow it.
+func (p *parser) parsePhrase() (string, error) {
+	start := p.offset
+	p.next()
+	for !p.done() {
+		r := p.next()
+		if r == '\\' && !p.done() {
+			p.next()
+		} else if r == '"' {
+			if !p.done() && !unicode.IsSpace(p.peek()) && p.peek() != ')' {
+				return "", p.errorAt(p.offset, "unexpected characters after the phrase, add a space before them")
+			}
+			return p.text[start:p.offset], nil
+		}
+	}
+	return "", p.errorAt(start, "missing '\"' to close this phrase")
+}
+
+// Parse a range, e.g. '[400 TO 499]', or '{1 TO 5}' to leave out the bounds.
+func (p *parser) parseRange() (string, error) {
+	start := p.offset
+	closing := ']'
+	if p.next() == '{' {
+		closing = '}'
+	}
+	end := strings.IndexRune(p.text[p.offset:], closing)
+	if end < 0 {
+		return "", p.errorAt(start, "missing '"+string(closing)+"' to close this range")
+	}
+	bounds := strings.Fields(p.text[p.offset : p.offset+end])
+	if len(bounds) != 3 || bounds[1] != "TO" {
+		return "", p.errorAt(start, "a range must be written '[low TO high]'")
+	}
+	p.offset += end + 1
+	return p.text[start:start+1] + bounds[0] + " TO " + bounds[2] + string(closing), nil
+}
+
+// Parse a comparison, e.g. '>=500'.
+func (p *parser) parseComparison() (string, error) {
+	start := p.offset
+	p.next()
+	if p.peek() == '=' {
+		p.next()
+	}
+	operator := p.text[start:p.offset]
+	if p.done() || unicode.IsSpace(p.peek()) || p.peek() == ')' {
+		return "", p.errorAt(start, "missing value after '"+operator+"'")
+	}
+	value, err := p.parseWord(false)
+	if err != nil {
+		return "", err
+	}
+	return operator + value, nil
+}
+
+// Combine nodes with AND or OR, merging the nodes that are already combined the same way.
+func flatten(parent Node, nodes []Node) Node {
+	switch combined := parent.(type) {
+	case *And:
+		for _, node := range nodes {
+			if and, ok := node.(*And); ok {
+				combined.Nodes = append(combined.Nodes, and.Nodes...)
+			} else {
+				combined.Nodes = append(combined.Nodes, node)
+			}
+		}
+	case *Or:
+		for _, node := range nodes {
+			if or, ok := node.(*Or); ok {
+				combined.Nodes = append(combined.Nodes, or.Nodes...)
+			} else {
+				combined.Nodes = append(combined.Nodes, node)
+			}
+		}
+	}
+	return parent
+}
@@ -0,0 +1,115 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Node A node of a parsed query: a term, a negation, or terms combined with AND or OR.
+type Node interface {
+	// String Format the node in the normalized query syntax.
+	String() string
+}
+
+// Term A search term: free text, a phrase, or a value of a tag or an @attribute, e.g. 'status:error',
+// '@http.status_code:[500 TO 599]', '@duration:>1000' or 'service:(api OR web)'.
+type Term struct {
+	Field  string
+	Value  string
+	Group  Node
+	Offset int
+}
+
+// Not A negated node, written '-term', '!term' or 'NOT term'.
+type Not struct {
+	Node Node
+}
+
+// And Nodes that must all match. Terms separated by spaces are combined with AND.
+type And struct {
+	Nodes []Node
+}
+
+// Or Nodes of which at least one must match.
+type Or struct {
+	Nodes []Node
+}
+
+// String Format the term.
+func (t *Term) String() string {
+	value := t.Value
+	if t.Group != nil {
+		value = "(" + t.Group.String() + ")"
+	}
+	if len(t.Field) > 0 {
+		return t.Field + ":" + value
+	}
+	return value
+}
+
+// String Format the negation.
+func (n *Not) String() string {
+	if _, ok := n.Node.(*Term); ok {
+		return "-" + n.Node.String()
+	}
+	return "-(" + n.Node.String() + ")"
+}
+
+// String Format the nodes joined with AND. Nodes joined with OR are grouped.
+func (a *And) String() string {
+	var parts []string
+	for _, node := range a.Nodes {
+		if _, ok := node.(*Or); ok {
+			parts = append(parts, "("+node.String()+")")
+		} else {
+			parts = append(parts, node.String())
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// String Format the nodes joined with OR. Nodes joined with AND are grouped, to make the precedence visible.
+func (o *Or) String() string {
+	var parts []string
+	for _, node := range o.Nodes {
+		if _, ok := node.(*And); ok {
+			parts = append(parts, "("+node.String()+")")
+		} else {
+			parts = append(parts, node.String())
+		}
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// Error A syntax error in a query, at a byte offset of the query.
+type Error struct {
+	Query   string
+	Offset  int
+	Message string
+}
+
+// Error Describe the error and its column.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at column %d", e.Message, e.Column())
+}
+
+// Column The column of the error, counting from 1.
+func (e *Error) Column() int {
+	return utf8.RuneCountInString(e.Query[:e.Offset]) + 1
+}
+
+// Caret Show the query with a caret under the error.
+func (e *Error) Caret() string {
+	return e.Query + "\n" + strings.Repeat(" ", e.Column()-1) + "^"
+}
+
+// Normalize Parse a query and format it in the normalized syntax: operators in capitals, explicit ANDs and single
+// spaces.
+func Normalize(text string) (string, error) {
+	node, err := Parse(text)
+	if err != nil || node == nil {
+		return "", err
+	}
+	return node.String(), nil
+}